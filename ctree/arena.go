@@ -0,0 +1,372 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+// This file contains a variant of the tree that keeps its nodes in a single
+// slice, like the arrays of the original C code.
+
+package ctree
+
+// nilNode is the index used for missing children. The first slot of the
+// arena is never used for storing a Frame.
+const nilNode int32 = 0
+
+// node is a Frame stored in an arena. Children are indices in the arena.
+type node[T Integer] struct {
+	Address T
+	Length  T
+	left    int32
+	right   int32
+}
+
+// frame returns the Frame stored in n.
+func (n *node[T]) frame() FrameOf[T] {
+	return FrameOf[T]{Address: n.Address, Length: n.Length}
+}
+
+// ArenaTreeOf is a cartesian tree with the same behaviour of CTree but whose
+// nodes are stored in a contiguous slice instead of being allocated one by
+// one. Frames are passed and returned by value and are identified by their
+// address. The slots of removed nodes are kept in a free list and reused.
+//
+// For large trees this greatly reduces the work of the garbage collector.
+type ArenaTreeOf[T Integer] struct {
+	nodes  []node[T]
+	root   int32
+	free   int32 // first free slot, the others are linked through left
+	Frames int
+}
+
+// ArenaTree is an ArenaTreeOf Frames with 32 bit address and length.
+type ArenaTree = ArenaTreeOf[int32]
+
+// ArenaTree64 is an ArenaTreeOf Frames with 64 bit address and length.
+type ArenaTree64 = ArenaTreeOf[int64]
+
+// NewArena returns a new tree with an initial root node of the given length
+// and located at address 0.
+func NewArena(length int32) *ArenaTree {
+	return NewArenaOf(length)
+}
+
+// NewArena64 is like NewArena but returns a tree with 64 bit addresses.
+func NewArena64(length int64) *ArenaTree64 {
+	return NewArenaOf(length)
+}
+
+// NewArenaOf is the generic version of NewArena.
+func NewArenaOf[T Integer](length T) *ArenaTreeOf[T] {
+	t := &ArenaTreeOf[T]{nodes: make([]node[T], 1, blockSize)}
+	t.Add(FrameOf[T]{Address: 0, Length: length})
+	return t
+}
+
+// alloc returns the index of an unused slot of the arena initialized with f.
+func (t *ArenaTreeOf[T]) alloc(f FrameOf[T]) int32 {
+	n := node[T]{Address: f.Address, Length: f.Length}
+	if t.free != nilNode {
+		i := t.free
+		t.free = t.nodes[i].left
+		t.nodes[i] = n
+		return i
+	}
+	if len(t.nodes) == 0 {
+		// zero value tree
+		t.nodes = append(t.nodes, node[T]{})
+	}
+	t.nodes = append(t.nodes, n)
+	return int32(len(t.nodes) - 1)
+}
+
+// release puts slot i in the free list.
+func (t *ArenaTreeOf[T]) release(i int32) {
+	t.nodes[i] = node[T]{left: t.free}
+	t.free = i
+}
+
+// split divides the subtree anchored at i in two subtrees, one with the
+// nodes whose address is smaller or equal to address and the other with
+// the rest. Both subtrees keep the length ordering.
+func (t *ArenaTreeOf[T]) split(i int32, address T) (l, r int32) {
+	ll, rl := &l, &r
+	for i != nilNode {
+		n := &t.nodes[i]
+		if n.Address <= address {
+			*ll = i
+			ll = &n.right
+			i = n.right
+		} else {
+			*rl = i
+			rl = &n.left
+			i = n.left
+		}
+	}
+	*ll, *rl = nilNode, nilNode
+	return
+}
+
+// merge joins two subtrees into a single one and returns its root.
+// It works like the function with the same name for Frames.
+func (t *ArenaTreeOf[T]) merge(l, r int32) int32 {
+	var root int32
+	link := &root
+	for l != nilNode && r != nilNode {
+		if t.nodes[l].Length >= t.nodes[r].Length {
+			*link = l
+			link = &t.nodes[l].right
+			l = t.nodes[l].right
+		} else {
+			*link = r
+			link = &t.nodes[r].left
+			r = t.nodes[r].left
+		}
+	}
+	if l != nilNode {
+		*link = l
+	} else {
+		*link = r
+	}
+	return root
+}
+
+// Add inserts a copy of f in the tree.
+func (t *ArenaTreeOf[T]) Add(f FrameOf[T]) {
+	i := t.alloc(f)
+
+	// the arena is not resized from here on, so pointers in it are stable
+	link := &t.root
+	for *link != nilNode && t.nodes[*link].Length >= f.Length {
+		if f.Address <= t.nodes[*link].Address {
+			link = &t.nodes[*link].left
+		} else {
+			link = &t.nodes[*link].right
+		}
+	}
+	t.nodes[i].left, t.nodes[i].right = t.split(*link, f.Address)
+	*link = i
+	t.Frames++
+	t.debugValidate()
+}
+
+// find returns a pointer to the link to the node starting at address, or
+// to an empty link if there is no such node.
+func (t *ArenaTreeOf[T]) find(address T) *int32 {
+	link := &t.root
+	for *link != nilNode && t.nodes[*link].Address != address {
+		if address < t.nodes[*link].Address {
+			link = &t.nodes[*link].left
+		} else {
+			link = &t.nodes[*link].right
+		}
+	}
+	return link
+}
+
+// Remove takes out of the tree the Frame with the same address and length
+// of f.
+func (t *ArenaTreeOf[T]) Remove(f FrameOf[T]) error {
+	link := t.find(f.Address)
+	if *link == nilNode || t.nodes[*link].Length != f.Length {
+		return ErrFrameNotFound
+	}
+	t.unlink(link)
+	return nil
+}
+
+// RemoveAt takes out of the tree the Frame starting at the given address
+// and returns it.
+func (t *ArenaTreeOf[T]) RemoveAt(address T) (FrameOf[T], error) {
+	link := t.find(address)
+	if *link == nilNode {
+		return FrameOf[T]{}, ErrFrameNotFound
+	}
+	f := t.nodes[*link].frame()
+	t.unlink(link)
+	return f, nil
+}
+
+// unlink replaces the node pointed to by link with the merge of its
+// subtrees and releases its slot.
+func (t *ArenaTreeOf[T]) unlink(link *int32) {
+	i := *link
+	*link = t.merge(t.nodes[i].left, t.nodes[i].right)
+	t.release(i)
+	t.Frames--
+	t.debugValidate()
+}
+
+// BetterFit returns the smallest Frame whose length is equal or larger than
+// size. See CTree.BetterFit. The boolean is false if no Frame is large
+// enough.
+func (t *ArenaTreeOf[T]) BetterFit(size T) (FrameOf[T], bool) {
+	if t.root == nilNode || t.nodes[t.root].Length < size {
+		return FrameOf[T]{}, false
+	}
+
+	best := t.root
+	todo := []int32{t.root}
+	for len(todo) > 0 {
+		i := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+		n, b := &t.nodes[i], &t.nodes[best]
+		if n.Length < b.Length || (n.Length == b.Length && n.Address < b.Address) {
+			best = i
+		}
+		if n.right != nilNode && t.nodes[n.right].Length >= size {
+			todo = append(todo, n.right)
+		}
+		if n.left != nilNode && t.nodes[n.left].Length >= size {
+			todo = append(todo, n.left)
+		}
+	}
+	return t.nodes[best].frame(), true
+}
+
+// FriendlyFit searches a free Frame where a block of the given size can be
+// placed at most tol slots away from pref. See CTree.FriendlyFit.
+// The boolean is false if there is no such Frame.
+func (t *ArenaTreeOf[T]) FriendlyFit(size, pref, tol T) (FrameOf[T], T, bool) {
+	if t.root == nilNode || t.nodes[t.root].Length < size {
+		return FrameOf[T]{}, 0, false
+	}
+
+	best := nilNode
+	var bestAddr, bestDist T
+	todo := []int32{t.root}
+	for len(todo) > 0 {
+		i := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+		n := &t.nodes[i]
+
+		f := n.frame()
+		addr, dist := nearest(&f, size, pref)
+		if dist <= tol && (best == nilNode || dist < bestDist || (dist == bestDist && addr < bestAddr)) {
+			best, bestAddr, bestDist = i, addr, dist
+		}
+
+		if n.right != nilNode && t.nodes[n.right].Length >= size && n.Address-pref < tol {
+			todo = append(todo, n.right)
+		}
+		if n.left != nilNode && t.nodes[n.left].Length >= size && n.Address-size >= pref-tol {
+			todo = append(todo, n.left)
+		}
+	}
+	if best == nilNode {
+		return FrameOf[T]{}, 0, false
+	}
+	return t.nodes[best].frame(), bestAddr, true
+}
+
+// neighbours returns the indices of the nodes immediately before and after
+// the given address.
+func (t *ArenaTreeOf[T]) neighbours(address T) (prev, next int32) {
+	i := t.root
+	for i != nilNode {
+		if address < t.nodes[i].Address {
+			next = i
+			i = t.nodes[i].left
+		} else {
+			prev = i
+			i = t.nodes[i].right
+		}
+	}
+	return
+}
+
+// Coalesce adds f to the tree merging it with the free Frames it touches on
+// either side. See CTree.Coalesce.
+func (t *ArenaTreeOf[T]) Coalesce(f FrameOf[T]) (FrameOf[T], error) {
+	var prev, next *FrameOf[T]
+	p, n := t.neighbours(f.Address)
+	if p != nilNode {
+		pf := t.nodes[p].frame()
+		prev = &pf
+	}
+	if n != nilNode {
+		nf := t.nodes[n].frame()
+		next = &nf
+	}
+	joinPrev, joinNext, err := f.Joins(prev, next)
+	if err != nil {
+		return FrameOf[T]{}, err
+	}
+
+	if joinPrev {
+		t.RemoveAt(prev.Address)
+		f.Address = prev.Address
+		f.Length += prev.Length
+	}
+	if joinNext {
+		t.RemoveAt(next.Address)
+		f.Length += next.Length
+	}
+	t.Add(f)
+	return f, nil
+}
+
+// Range calls visit, by increasing address, for all the Frames that have
+// at least one slot in the interval [lo, hi). See CTree.Range.
+func (t *ArenaTreeOf[T]) Range(lo, hi T, visit func(FrameOf[T]) error) error {
+	var todo []int32
+	i := t.root
+	for i != nilNode || len(todo) > 0 {
+		for i != nilNode {
+			todo = append(todo, i)
+			if t.nodes[i].Address > lo {
+				i = t.nodes[i].left
+			} else {
+				i = nilNode
+			}
+		}
+		n := &t.nodes[todo[len(todo)-1]]
+		todo = todo[:len(todo)-1]
+		if n.Address >= hi {
+			return nil
+		}
+		if lo-n.Address < n.Length {
+			if err := visit(n.frame()); err != nil {
+				return stopped(err)
+			}
+		}
+		if hi-n.Address > 1 {
+			i = n.right
+		}
+	}
+	return nil
+}
+
+// Validate walks the whole tree and checks that all its invariants hold.
+// See CTree.Validate.
+func (t *ArenaTreeOf[T]) Validate() error {
+	return t.pointers().Validate()
+}
+
+// pointers returns a copy of the tree made of Frames linked by pointers.
+func (t *ArenaTreeOf[T]) pointers() *CTreeOf[T] {
+	frames := make(map[int32]*FrameOf[T], t.Frames)
+	var build func(i int32) *FrameOf[T]
+	build = func(i int32) *FrameOf[T] {
+		if i == nilNode {
+			return nil
+		}
+		if _, ok := frames[i]; ok {
+			// a cycle, cut it
+			return nil
+		}
+		f := &FrameOf[T]{Address: t.nodes[i].Address, Length: t.nodes[i].Length}
+		frames[i] = f
+		f.left = build(t.nodes[i].left)
+		f.right = build(t.nodes[i].right)
+		return f
+	}
+	return &CTreeOf[T]{root: build(t.root), Frames: t.Frames}
+}
+
+// debugValidate panics if Debug is enabled and the tree is not valid.
+func (t *ArenaTreeOf[T]) debugValidate() {
+	if Debug {
+		if err := t.Validate(); err != nil {
+			panic(err)
+		}
+	}
+}
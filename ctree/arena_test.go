@@ -0,0 +1,207 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package ctree
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func arenaFrames(t *ArenaTree) []Frame {
+	frames := make([]Frame, 0, t.Frames)
+	t.Range(0, 1<<30, func(f Frame) error {
+		frames = append(frames, f)
+		return nil
+	})
+	return frames
+}
+
+func treeFrames(t *CTree) []Frame {
+	frames := make([]Frame, 0, t.Frames)
+	t.Range(0, 1<<30, func(f *Frame) error {
+		frames = append(frames, Frame{Address: f.Address, Length: f.Length})
+		return nil
+	})
+	return frames
+}
+
+func TestArenaAdd(t *testing.T) {
+	tree := NewArena(20)
+	tree.Add(Frame{Address: 130, Length: 40})
+	tree.Add(Frame{Address: 410, Length: 5})
+	tree.Add(Frame{Address: 210, Length: 20})
+	tree.Add(Frame{Address: 180, Length: 25})
+	tree.Add(Frame{Address: 500, Length: 30})
+	tree.Add(Frame{Address: 300, Length: 35})
+
+	assert.Equal(t, 7, tree.Frames)
+	assert.NoError(t, tree.Validate())
+	assert.Equal(t, "[130,40][0,20][300,35][180,25][210,20][500,30][410,5]", preOrder(tree.pointers()))
+}
+
+func TestArenaRemove(t *testing.T) {
+	tree := NewArena(100)
+	tree.Add(Frame{Address: 200, Length: 80})
+	tree.Add(Frame{Address: 500, Length: 300})
+
+	assert.Equal(t, ErrFrameNotFound, tree.Remove(Frame{Address: 200, Length: 10}))
+	assert.NoError(t, tree.Remove(Frame{Address: 200, Length: 80}))
+	assert.Equal(t, 2, tree.Frames)
+
+	f, err := tree.RemoveAt(500)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "[500,300]", f.String())
+		assert.Equal(t, 1, tree.Frames)
+	}
+	_, err = tree.RemoveAt(500)
+	assert.Equal(t, ErrFrameNotFound, err)
+	assert.NoError(t, tree.Validate())
+}
+
+func TestArenaReuse(t *testing.T) {
+	tree := NewArena(100)
+	tree.Add(Frame{Address: 200, Length: 80})
+	tree.RemoveAt(200)
+	tree.Add(Frame{Address: 300, Length: 80})
+
+	assert.Len(t, tree.nodes, 3)
+	assert.Equal(t, []Frame{{Address: 0, Length: 100}, {Address: 300, Length: 80}}, arenaFrames(tree))
+}
+
+func TestArenaZeroValue(t *testing.T) {
+	var tree ArenaTree
+	tree.Add(Frame{Address: 200, Length: 80})
+
+	f, ok := tree.BetterFit(10)
+	assert.True(t, ok)
+	assert.Equal(t, "[200,80]", f.String())
+}
+
+// TestArenaSameAsCTree performs the same random operations on both trees
+// and compares the results.
+func TestArenaSameAsCTree(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	const size = 10000
+	ct, at := New(size), NewArena(size)
+
+	for i := 0; i < 5000; i++ {
+		length := int32(r.Intn(100) + 1)
+		switch r.Intn(3) {
+		case 0:
+			f, ok := at.BetterFit(length)
+			cf := ct.BetterFit(length)
+			if assert.Equal(t, cf != nil, ok) && ok {
+				assert.Equal(t, cf.String(), f.String())
+			}
+		case 1:
+			pref, tol := int32(r.Intn(size)), int32(r.Intn(200))
+			f, addr, ok := at.FriendlyFit(length, pref, tol)
+			cf, caddr := ct.FriendlyFit(length, pref, tol)
+			if assert.Equal(t, cf != nil, ok) && ok {
+				assert.Equal(t, cf.String(), f.String())
+				assert.Equal(t, caddr, addr)
+				// allocate the block in both trees
+				at.RemoveAt(f.Address)
+				ct.Remove(cf)
+				if addr > f.Address {
+					at.Add(Frame{Address: f.Address, Length: addr - f.Address})
+					ct.Add(&Frame{Address: f.Address, Length: addr - f.Address})
+				}
+				if rest := f.Address + f.Length - addr - length; rest > 0 {
+					at.Add(Frame{Address: addr + length, Length: rest})
+					ct.Add(&Frame{Address: addr + length, Length: rest})
+				}
+			}
+		case 2:
+			f := Frame{Address: int32(r.Intn(size)), Length: length}
+			af, aerr := at.Coalesce(f)
+			cf, cerr := ct.Coalesce(&Frame{Address: f.Address, Length: f.Length})
+			if assert.Equal(t, cerr, aerr) && aerr == nil {
+				assert.Equal(t, cf.String(), af.String())
+			}
+		}
+		assert.Equal(t, ct.Frames, at.Frames)
+	}
+	assert.NoError(t, at.Validate())
+	assert.Equal(t, treeFrames(ct), arenaFrames(at))
+}
+
+// benchmarkTrees runs ops on both kinds of trees.
+func benchmarkTrees(b *testing.B, ops func(add func(Frame), fit func(int32), remove func(int32))) {
+	b.Run("CTree", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			t := &CTree{}
+			ops(func(f Frame) { t.Add(&Frame{Address: f.Address, Length: f.Length}) },
+				func(size int32) { t.BetterFit(size) },
+				func(address int32) { t.RemoveAt(address) })
+		}
+	})
+	b.Run("Arena", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			t := &ArenaTree{}
+			ops(t.Add,
+				func(size int32) { t.BetterFit(size) },
+				func(address int32) { t.RemoveAt(address) })
+		}
+	})
+}
+
+// benchFrames returns n non overlapping Frames of random length in random
+// order.
+func benchFrames(n int) []Frame {
+	r := rand.New(rand.NewSource(1))
+	frames := make([]Frame, n)
+	for i, p := range r.Perm(n) {
+		frames[i] = Frame{Address: int32(p) * 100, Length: int32(r.Intn(99) + 1)}
+	}
+	return frames
+}
+
+func BenchmarkAdd(b *testing.B) {
+	frames := benchFrames(10000)
+	benchmarkTrees(b, func(add func(Frame), _ func(int32), _ func(int32)) {
+		for _, f := range frames {
+			add(f)
+		}
+	})
+}
+
+func BenchmarkAddRemove(b *testing.B) {
+	frames := benchFrames(10000)
+	benchmarkTrees(b, func(add func(Frame), _ func(int32), remove func(int32)) {
+		for _, f := range frames {
+			add(f)
+		}
+		for _, f := range frames {
+			remove(f.Address)
+		}
+	})
+}
+
+func BenchmarkBetterFit(b *testing.B) {
+	frames := benchFrames(10000)
+	benchmarkTrees(b, func(add func(Frame), fit func(int32), _ func(int32)) {
+		for _, f := range frames {
+			add(f)
+		}
+		for size := int32(1); size < 100; size++ {
+			fit(size)
+		}
+	})
+}
+
+func TestArena64(t *testing.T) {
+	tree := NewArena64(1 << 40)
+	tree.Add(Frame64{Address: 1<<41 + 10, Length: 1 << 35})
+
+	f, ok := tree.BetterFit(1 << 34)
+	assert.True(t, ok)
+	assert.Equal(t, "[2199023255562,34359738368]", f.String())
+	assert.NoError(t, tree.Validate())
+}
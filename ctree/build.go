@@ -0,0 +1,56 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+// This file contains code for building a tree from a list of Frames
+
+package ctree
+
+import "github.com/pkg/errors"
+
+// Build returns a tree containing the given Frames, which must be sorted by
+// address and must not overlap. See BuildOf.
+func Build(frames []*Frame) (*CTree, error) {
+	return BuildOf(frames)
+}
+
+// Build64 is like Build but for Frames with 64 bit addresses.
+func Build64(frames []*Frame64) (*CTree64, error) {
+	return BuildOf(frames)
+}
+
+// BuildOf returns a tree containing the given Frames, which must be sorted
+// by address and must not overlap. The Frames are linked directly in the
+// tree and their current children are discarded.
+//
+// The tree is built in linear time using a stack that holds its right spine:
+// each new Frame takes the place of the shorter Frames at the bottom of the
+// spine, which become its left subtree.
+func BuildOf[T Integer](frames []*FrameOf[T]) (*CTreeOf[T], error) {
+	s := newStack[T]()
+	var prev *FrameOf[T]
+	for _, f := range frames {
+		if prev != nil {
+			if pos := prev.position(f); pos != right && pos != touchRight {
+				return nil, errors.Errorf("frame %v is not after frame %v", *f, *prev)
+			}
+		}
+		prev = f
+
+		f.DetachChildren()
+		for !s.empty() && s.peek().Length < f.Length {
+			f.left, _ = s.pop()
+		}
+		if !s.empty() {
+			s.peek().right = f
+		}
+		s.push(f)
+	}
+
+	t := &CTreeOf[T]{Frames: len(frames)}
+	if !s.empty() {
+		t.root = s.frames[0]
+	}
+	t.debugValidate()
+	return t, nil
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package ctree
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuild(t *testing.T) {
+	tree, err := Build([]*Frame{
+		NewFrame(0, 20),
+		NewFrame(130, 40),
+		NewFrame(180, 25),
+		NewFrame(210, 20),
+		NewFrame(300, 35),
+		NewFrame(410, 5),
+		NewFrame(500, 30),
+	})
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, 7, tree.Frames)
+		assert.NoError(t, tree.Validate())
+		assert.Equal(t, preOrder(newValidTree()), preOrder(tree))
+	}
+}
+
+func TestBuildEmpty(t *testing.T) {
+	tree, err := Build(nil)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, tree.Frames)
+		assert.Nil(t, tree.BetterFit(1))
+	}
+}
+
+func TestBuildSameAsAdd(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var frames []*Frame
+	added := &CTree{}
+	address := int32(0)
+	for i := 0; i < 1000; i++ {
+		address += int32(r.Intn(10))
+		f := NewFrame(address, int32(r.Intn(1000)+1))
+		frames = append(frames, f)
+		added.Add(NewFrame(f.Address, f.Length))
+		address += f.Length
+	}
+
+	tree, err := Build(frames)
+
+	if assert.NoError(t, err) {
+		assert.NoError(t, tree.Validate())
+		assert.Equal(t, treeFrames(added), treeFrames(tree))
+	}
+}
+
+func TestBuildUnsorted(t *testing.T) {
+	_, err := Build([]*Frame{NewFrame(100, 20), NewFrame(0, 20)})
+	assert.EqualError(t, err, "frame [0,20] is not after frame [100,20]")
+
+	_, err = Build([]*Frame{NewFrame(0, 20), NewFrame(10, 20)})
+	assert.EqualError(t, err, "frame [10,20] is not after frame [0,20]")
+}
+
+func BenchmarkBuild(b *testing.B) {
+	frames := make([]*Frame, 10000)
+	for i := range frames {
+		frames[i] = NewFrame(int32(i)*100, int32(i*7919%99+1))
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Build(frames)
+	}
+}
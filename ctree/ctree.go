@@ -19,6 +19,10 @@ From rule 1 derives that the root of the tree always contains the node with
 the greates length. This characteristic is useful when using ctree to store
 memory segments.
 
+The tree is generic on the integer type of addresses and lengths. Frame and
+CTree use 32 bit integers like Tierra, Frame64 and CTree64 can be used for
+larger address spaces.
+
 See more at https://en.wikipedia.org/wiki/Cartesian_tree
 */
 package ctree
@@ -29,18 +33,34 @@ import (
 	"github.com/pkg/errors"
 )
 
+// ErrStop can be returned by the visit functions of the traversals to stop
+// the iteration early. The traversal then returns nil instead of an error.
+var ErrStop = errors.New("stop iteration")
+
 //---- Frame -------------------------------------------------------------
 
-// Frame represents a segment of free memory.
-type Frame struct {
-	Address int32
-	Length  int32
-	left    *Frame
-	right   *Frame
+// Integer is the constraint for the types of addresses and lengths.
+type Integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64
+}
+
+// FrameOf represents a segment of free memory whose address and length are
+// of type T. Addresses and lengths are never negative.
+type FrameOf[T Integer] struct {
+	Address T
+	Length  T
+	left    *FrameOf[T]
+	right   *FrameOf[T]
 }
 
+// Frame is a segment of free memory with 32 bit address and length.
+type Frame = FrameOf[int32]
+
+// Frame64 is a segment of free memory with 64 bit address and length.
+type Frame64 = FrameOf[int64]
+
 // Add adds a new Frame to the subtree anchored at this Frame.
-func (f *Frame) Add(nf, parent *Frame) {
+func (f *FrameOf[T]) Add(nf, parent *FrameOf[T]) {
 	current := f
 	loop := true
 
@@ -72,39 +92,65 @@ func (f *Frame) Add(nf, parent *Frame) {
 }
 
 // append takes a subtree and moves it in the right position below this Frame.
-// The part of the tree affected by the insertion is also rebalanced.
-func (f *Frame) append(child *Frame) {
-	var tbr *Frame
-	if child.Address <= f.Address {
-		f.left = child
-		// rebalance child.right
-		if child.right != nil {
-			tbr = child.right
-			child.right = nil
+// The subtree is split by the address of f: nodes at smaller or equal
+// addresses go to the left, the others to the right. Only the nodes on the
+// path of the split are relinked, so the cost is proportional to the height
+// of the subtree instead of its size.
+func (f *FrameOf[T]) append(child *FrameOf[T]) {
+	f.left, f.right = split(child, f.Address)
+}
+
+// split divides the subtree anchored at f in two subtrees, one with the
+// nodes whose address is smaller or equal to address and the other with
+// the rest. Both subtrees keep the length ordering.
+func split[T Integer](f *FrameOf[T], address T) (l, r *FrameOf[T]) {
+	ll, rl := &l, &r
+	for f != nil {
+		if f.Address <= address {
+			*ll = f
+			ll = &f.right
+			f = f.right
+		} else {
+			*rl = f
+			rl = &f.left
+			f = f.left
+		}
+	}
+	*ll, *rl = nil, nil
+	return
+}
+
+// merge joins two subtrees into a single one and returns its root.
+// All the addresses in l must be smaller or equal to those in r.
+// The spine of the result is built by always taking the longest of the two
+// current heads, thus preserving the length ordering.
+func merge[T Integer](l, r *FrameOf[T]) *FrameOf[T] {
+	var root *FrameOf[T]
+	link := &root
+	for l != nil && r != nil {
+		if l.Length >= r.Length {
+			*link = l
+			link = &l.right
+			l = l.right
+		} else {
+			*link = r
+			link = &r.left
+			r = r.left
 		}
+	}
+	if l != nil {
+		*link = l
 	} else {
-		f.right = child
-		// rebalance child.left
-		if child.left != nil {
-			tbr = child.left
-			child.left = nil
-		}
-	}
-	// rebalance if needed
-	if tbr != nil {
-		tbr.TraversePost(func(tf *Frame) error {
-			tf.DetachChildren()
-			// parent can be nil because we know we are appending strictly below f
-			f.Add(tf, nil)
-			return nil
-		})
+		*link = r
 	}
+	return root
 }
 
 // TraversePre iterates over the subtree anchored at f in pre-order
 // depth-first mode.
-// Each node is provided to function visit for processing.
-func (f *Frame) TraversePre(visit func(*Frame) error) error {
+// Each node is provided to function visit for processing. Returning ErrStop
+// from visit ends the traversal.
+func (f *FrameOf[T]) TraversePre(visit func(*FrameOf[T]) error) error {
 	s := newStackWith(f)
 	for !s.empty() {
 		current, err := s.pop()
@@ -112,7 +158,7 @@ func (f *Frame) TraversePre(visit func(*Frame) error) error {
 			return errors.Wrap(err, "stack error")
 		}
 		if err = visit(current); err != nil {
-			return err
+			return stopped(err)
 		}
 		// by pushing right first, we visit the left subtree first
 		if current.right != nil {
@@ -127,9 +173,10 @@ func (f *Frame) TraversePre(visit func(*Frame) error) error {
 
 // TraversePost iterates over the subtree anchored at f in post-order
 // depth-first mode.
-// Each node is provided to function visit for processing.
+// Each node is provided to function visit for processing. Returning ErrStop
+// from visit ends the traversal.
 // Inspired by: https://stackoverflow.com/a/16092333/2774065
-func (f *Frame) TraversePost(visit func(*Frame) error) error {
+func (f *FrameOf[T]) TraversePost(visit func(*FrameOf[T]) error) error {
 	s := newStackWith(f)
 	current := f
 	for !s.empty() {
@@ -142,7 +189,7 @@ func (f *Frame) TraversePost(visit func(*Frame) error) error {
 				return errors.Wrap(err, "stack error")
 			}
 			if err = visit(next); err != nil {
-				return err
+				return stopped(err)
 			}
 			current = next
 		} else {
@@ -157,29 +204,85 @@ func (f *Frame) TraversePost(visit func(*Frame) error) error {
 	return nil
 }
 
+// TraverseIn iterates over the subtree anchored at f in in-order
+// depth-first mode, i.e. by increasing address.
+// Each node is provided to function visit for processing. Returning ErrStop
+// from visit ends the traversal.
+func (f *FrameOf[T]) TraverseIn(visit func(*FrameOf[T]) error) error {
+	s := newStack[T]()
+	current := f
+	for current != nil || !s.empty() {
+		for current != nil {
+			s.push(current)
+			current = current.left
+		}
+		next, err := s.pop()
+		if err != nil {
+			return errors.Wrap(err, "stack error")
+		}
+		if err = visit(next); err != nil {
+			return stopped(err)
+		}
+		current = next.right
+	}
+	return nil
+}
+
+// stopped filters out ErrStop from the errors returned by visit functions.
+func stopped(err error) error {
+	if err == ErrStop {
+		return nil
+	}
+	return err
+}
+
 // DetachChildren resets the left and right pinters of this Frame.
-func (f *Frame) DetachChildren() {
+func (f *FrameOf[T]) DetachChildren() {
 	f.left, f.right = nil, nil
 }
 
+// widen returns a detached copy of f with 64 bit address and length.
+func widen[T Integer](f *FrameOf[T]) Frame64 {
+	return Frame64{Address: int64(f.Address), Length: int64(f.Length)}
+}
+
 // String returns a string representation of the Frame.
-func (f Frame) String() string {
+func (f FrameOf[T]) String() string {
 	return fmt.Sprintf("[%d,%d]", f.Address, f.Length)
 }
 
 //---- CTree -------------------------------------------------------------
 
-// CTree is the cartesian tree containing the free memory segments.
-type CTree struct {
-	root   *Frame
+// ErrFrameNotFound is returned when a Frame to be removed is not in the tree.
+var ErrFrameNotFound = errors.New("frame not found")
+
+// CTreeOf is the cartesian tree containing the free memory segments.
+type CTreeOf[T Integer] struct {
+	root   *FrameOf[T]
 	Frames int
 }
 
+// CTree is a tree of Frames with 32 bit address and length.
+type CTree = CTreeOf[int32]
+
+// CTree64 is a tree of Frames with 64 bit address and length.
+type CTree64 = CTreeOf[int64]
+
 // New return a new tree with an initial root node of the given length
 // and located at address 0.
 func New(length int32) *CTree {
-	return &CTree{
-		root:   &Frame{Address: 0, Length: length},
+	return NewOf(length)
+}
+
+// New64 is like New but returns a tree with 64 bit addresses.
+func New64(length int64) *CTree64 {
+	return NewOf(length)
+}
+
+// NewOf is the generic version of New.
+func NewOf[T Integer](length T) *CTreeOf[T] {
+	return &CTreeOf[T]{
+		root:   &FrameOf[T]{Address: 0, Length: length},
 		Frames: 1,
 	}
 }
@@ -187,24 +290,19 @@ func New(length int32) *CTree {
 // Add inserts a frame to the tree. This function handles cases related to
 // the root of the tree. Once the root cases have been handled, it delegates
 // to the Frame's method with the same name.
-func (t *CTree) Add(nf *Frame) {
+func (t *CTreeOf[T]) Add(nf *FrameOf[T]) {
+	defer t.debugValidate()
+
+	if t.root == nil {
+		// empty tree
+		t.root = nf
+		t.Frames++
+		return
+	}
+
 	if nf.Length >= t.root.Length {
-		// root insertion
-		if nf.Address <= t.root.Address {
-			// new is to the left
-			nf.right = t.root
-			if nf.right.left != nil {
-				// rebalance
-				nf.append(nf.right.left)
-			}
-		} else {
-			// new is to the right
-			nf.left = t.root
-			if nf.left.right != nil {
-				// rebalance
-				nf.append(nf.left.right)
-			}
-		}
+		// root insertion, the old root is moved below the new one
+		nf.append(t.root)
 		t.Frames++
 		t.root = nf
 		return
@@ -226,3 +324,172 @@ func (t *CTree) Add(nf *Frame) {
 	}
 	t.Frames++
 }
+
+// Remove takes Frame f out of the tree. The left and right subtrees of f are
+// merged and take its place. Once removed, f has no children and can be
+// reused or added again to a tree.
+func (t *CTreeOf[T]) Remove(f *FrameOf[T]) error {
+	link := &t.root
+	for *link != nil && *link != f {
+		if f.Address <= (*link).Address {
+			link = &(*link).left
+		} else {
+			link = &(*link).right
+		}
+	}
+	if *link == nil {
+		return ErrFrameNotFound
+	}
+	t.unlink(link)
+	return nil
+}
+
+// RemoveAt takes out of the tree the Frame starting at the given address
+// and returns it.
+func (t *CTreeOf[T]) RemoveAt(address T) (*FrameOf[T], error) {
+	link := &t.root
+	for *link != nil && (*link).Address != address {
+		if address < (*link).Address {
+			link = &(*link).left
+		} else {
+			link = &(*link).right
+		}
+	}
+	if *link == nil {
+		return nil, ErrFrameNotFound
+	}
+	f := *link
+	t.unlink(link)
+	return f, nil
+}
+
+// unlink replaces the Frame pointed to by link with the merge of its
+// subtrees.
+func (t *CTreeOf[T]) unlink(link **FrameOf[T]) {
+	f := *link
+	*link = merge(f.left, f.right)
+	f.DetachChildren()
+	t.Frames--
+	t.debugValidate()
+}
+
+// BetterFit returns the smallest Frame whose length is equal or larger than
+// size, or nil if no Frame is large enough. When several Frames have the same
+// length, the one with the lowest address is returned.
+// Thanks to the length ordering, subtrees whose root is smaller than size are
+// never visited.
+func (t *CTreeOf[T]) BetterFit(size T) *FrameOf[T] {
+	if t.root == nil || t.root.Length < size {
+		return nil
+	}
+
+	best := t.root
+	s := newStackWith(t.root)
+	for !s.empty() {
+		current, _ := s.pop()
+		if current.Length < best.Length ||
+			(current.Length == best.Length && current.Address < best.Address) {
+			best = current
+		}
+		if current.right != nil && current.right.Length >= size {
+			s.push(current.right)
+		}
+		if current.left != nil && current.left.Length >= size {
+			s.push(current.left)
+		}
+	}
+	return best
+}
+
+// FriendlyFit searches a free Frame where a block of the given size can be
+// placed at an address that differs from pref by at most tol.
+// The Frame and the address nearest to pref are returned. When two addresses
+// are at the same distance from pref, the lowest one wins.
+// If there is no such Frame, nil is returned.
+func (t *CTreeOf[T]) FriendlyFit(size, pref, tol T) (*FrameOf[T], T) {
+	if t.root == nil || t.root.Length < size {
+		return nil, 0
+	}
+
+	var best *FrameOf[T]
+	var bestAddr, bestDist T
+	s := newStackWith(t.root)
+	for !s.empty() {
+		current, _ := s.pop()
+
+		addr, dist := nearest(current, size, pref)
+		if dist <= tol && (best == nil || dist < bestDist || (dist == bestDist && addr < bestAddr)) {
+			best, bestAddr, bestDist = current, addr, dist
+		}
+
+		// blocks in the right subtree start after current.Address, blocks in
+		// the left one end before it
+		if current.right != nil && current.right.Length >= size && current.Address-pref < tol {
+			s.push(current.right)
+		}
+		if current.left != nil && current.left.Length >= size && current.Address-size >= pref-tol {
+			s.push(current.left)
+		}
+	}
+	return best, bestAddr
+}
+
+// nearest returns the address closest to pref where a block of the given
+// size can be placed inside f, together with its distance from pref.
+//
+// Here and in the rest of the package, the end of a Frame is never computed
+// as Address + Length because it can overflow T. Differences between
+// addresses, which are never negative, are used instead.
+func nearest[T Integer](f *FrameOf[T], size, pref T) (addr, dist T) {
+	addr = pref
+	if max := f.Address + (f.Length - size); addr > max {
+		addr = max
+	}
+	if addr < f.Address {
+		addr = f.Address
+	}
+	dist = addr - pref
+	if dist < 0 {
+		dist = -dist
+	}
+	return
+}
+
+// Range calls visit, by increasing address, for all the Frames that have
+// at least one slot in the interval [lo, hi). Subtrees that can not contain
+// such Frames are not visited.
+// As in the traversal functions, an error returned by visit stops the
+// iteration and is returned to the caller, unless it is ErrStop.
+func (t *CTreeOf[T]) Range(lo, hi T, visit func(*FrameOf[T]) error) error {
+	s := newStack[T]()
+	current := t.root
+	for current != nil || !s.empty() {
+		for current != nil {
+			s.push(current)
+			// the left subtree ends before current
+			if current.Address > lo {
+				current = current.left
+			} else {
+				current = nil
+			}
+		}
+		next, err := s.pop()
+		if err != nil {
+			return errors.Wrap(err, "stack error")
+		}
+		if next.Address >= hi {
+			// all the Frames still to be visited start after hi
+			return nil
+		}
+		if lo-next.Address < next.Length {
+			if err = visit(next); err != nil {
+				return stopped(err)
+			}
+		}
+		// the right subtree starts after current
+		if hi-next.Address > 1 {
+			current = next.right
+		}
+	}
+	return nil
+}
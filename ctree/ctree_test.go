@@ -5,6 +5,10 @@
 package ctree
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
 	"strings"
 	"testing"
 
@@ -204,3 +208,408 @@ func TestRebalanceLeft(t *testing.T) {
 	result := strings.Join(nodes, "")
 	assert.Equal(t, "[130,40][0,20][300,35][180,25][210,20][500,30][410,5][700,20][630,10]", result)
 }
+
+// TestRebalanceZigzag inserts a Frame above a subtree whose nodes alternate
+// on the two sides of its address, so that the split takes a turn at every
+// level.
+func TestRebalanceZigzag(t *testing.T) {
+	tree := &CTree{}
+	tree.Add(NewFrame(5000, 100))
+	tree.Add(NewFrame(2000, 90))
+	tree.Add(NewFrame(4000, 80))
+	tree.Add(NewFrame(2500, 70))
+	tree.Add(NewFrame(3500, 60))
+	tree.Add(NewFrame(3000, 50))
+
+	tree.Add(NewFrame(3200, 85)) // triggers rebalance
+
+	assert.Equal(t, "[5000,100][2000,90][3200,85][2500,70][3000,50][4000,80][3500,60]", preOrder(tree))
+	assert.NoError(t, tree.Validate())
+}
+
+// TestAddShape checks that Add builds the only tree possible for Frames of
+// distinct lengths, whatever the order of insertion.
+func TestAddShape(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	const n = 500
+	lengths := r.Perm(n)
+	frames := make([]*Frame, n)
+	for i := range frames {
+		frames[i] = NewFrame(int32(i)*1000, int32(lengths[i])+1)
+	}
+	want, _ := Build(frames)
+
+	for round := 0; round < 10; round++ {
+		tree := &CTree{}
+		for _, i := range r.Perm(n) {
+			tree.Add(NewFrame(int32(i)*1000, int32(lengths[i])+1))
+		}
+		if !assert.NoError(t, tree.Validate()) {
+			return
+		}
+		assert.Equal(t, preOrder(want), preOrder(tree))
+	}
+}
+
+func preOrder(tree *CTree) string {
+	nodes := make([]string, 0, tree.Frames)
+	if tree.root != nil {
+		tree.root.TraversePre(func(f *Frame) error {
+			nodes = append(nodes, f.String())
+			return nil
+		})
+	}
+	return strings.Join(nodes, "")
+}
+
+func TestRemoveRoot(t *testing.T) {
+	tree := New(20)
+	tree.Add(NewFrame(130, 40))
+	tree.Add(NewFrame(410, 5))
+	tree.Add(NewFrame(210, 20))
+	tree.Add(NewFrame(180, 25))
+	tree.Add(NewFrame(500, 30))
+	tree.Add(NewFrame(300, 35))
+
+	err := tree.Remove(tree.root)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, 6, tree.Frames)
+		assert.Equal(t, "[300,35][180,25][0,20][210,20][500,30][410,5]", preOrder(tree))
+	}
+}
+
+func TestRemoveInner(t *testing.T) {
+	tree := New(5)
+	tree.Add(NewFrame(250, 20))
+	tree.Add(NewFrame(280, 10))
+	tree.Add(NewFrame(350, 15))
+	tree.Add(NewFrame(470, 35))
+	f := NewFrame(300, 25)
+	tree.Add(f)
+
+	err := tree.Remove(f)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, 5, tree.Frames)
+		assert.Equal(t, "[470,35][250,20][0,5][350,15][280,10]", preOrder(tree))
+		assert.Nil(t, f.left)
+		assert.Nil(t, f.right)
+	}
+}
+
+func TestRemoveLeaf(t *testing.T) {
+	tree := New(100)
+	f := NewFrame(200, 50)
+	tree.Add(f)
+
+	err := tree.Remove(f)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, tree.Frames)
+		assert.Equal(t, "[0,100]", preOrder(tree))
+	}
+}
+
+func TestRemoveMissing(t *testing.T) {
+	tree := New(100)
+	tree.Add(NewFrame(200, 50))
+
+	err := tree.Remove(NewFrame(200, 50))
+
+	assert.Equal(t, ErrFrameNotFound, err)
+	assert.Equal(t, 2, tree.Frames)
+}
+
+func TestRemoveLast(t *testing.T) {
+	tree := New(100)
+
+	err := tree.Remove(tree.root)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, tree.Frames)
+		assert.Nil(t, tree.root)
+	}
+
+	tree.Add(NewFrame(200, 50))
+	assert.Equal(t, 1, tree.Frames)
+	assert.Equal(t, "[200,50]", preOrder(tree))
+}
+
+func TestRemoveAt(t *testing.T) {
+	tree := New(100)
+	tree.Add(NewFrame(200, 80))
+	tree.Add(NewFrame(500, 300))
+	tree.Add(NewFrame(1000, 80))
+
+	f, err := tree.RemoveAt(200)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, int32(80), f.Length)
+		assert.Equal(t, 3, tree.Frames)
+		assert.Equal(t, "[500,300][0,100][1000,80]", preOrder(tree))
+	}
+
+	_, err = tree.RemoveAt(300)
+	assert.Equal(t, ErrFrameNotFound, err)
+}
+
+func TestBetterFit(t *testing.T) {
+	tree := New(20)
+	tree.Add(NewFrame(130, 40))
+	tree.Add(NewFrame(410, 5))
+	tree.Add(NewFrame(210, 20))
+	tree.Add(NewFrame(180, 25))
+	tree.Add(NewFrame(500, 30))
+	tree.Add(NewFrame(300, 35))
+
+	assert.Equal(t, "[180,25]", tree.BetterFit(21).String())
+	assert.Equal(t, "[300,35]", tree.BetterFit(31).String())
+	assert.Equal(t, "[130,40]", tree.BetterFit(40).String())
+	assert.Equal(t, "[410,5]", tree.BetterFit(1).String())
+}
+
+func TestBetterFitTie(t *testing.T) {
+	tree := New(20)
+	tree.Add(NewFrame(130, 40))
+	tree.Add(NewFrame(210, 20))
+	tree.Add(NewFrame(500, 20))
+
+	assert.Equal(t, "[0,20]", tree.BetterFit(15).String())
+}
+
+func TestBetterFitNone(t *testing.T) {
+	tree := New(20)
+	tree.Add(NewFrame(130, 40))
+
+	assert.Nil(t, tree.BetterFit(41))
+	assert.Nil(t, (&CTree{}).BetterFit(1))
+}
+
+func TestFriendlyFit(t *testing.T) {
+	tree := New(20)
+	tree.Add(NewFrame(130, 40))
+	tree.Add(NewFrame(210, 20))
+	tree.Add(NewFrame(300, 35))
+	tree.Add(NewFrame(500, 30))
+
+	f, addr := tree.FriendlyFit(10, 140, 0)
+	assert.Equal(t, "[130,40]", f.String())
+	assert.Equal(t, int32(140), addr)
+
+	f, addr = tree.FriendlyFit(10, 250, 30)
+	assert.Equal(t, "[210,20]", f.String())
+	assert.Equal(t, int32(220), addr)
+
+	f, addr = tree.FriendlyFit(10, 285, 30)
+	assert.Equal(t, "[300,35]", f.String())
+	assert.Equal(t, int32(300), addr)
+
+	f, addr = tree.FriendlyFit(30, 450, 60)
+	assert.Equal(t, "[500,30]", f.String())
+	assert.Equal(t, int32(500), addr)
+}
+
+func TestFriendlyFitTie(t *testing.T) {
+	tree := New(20)
+	tree.Add(NewFrame(100, 20))
+
+	f, addr := tree.FriendlyFit(10, 55, 50)
+	assert.Equal(t, "[0,20]", f.String())
+	assert.Equal(t, int32(10), addr)
+}
+
+func TestFriendlyFitNone(t *testing.T) {
+	tree := New(20)
+	tree.Add(NewFrame(130, 40))
+
+	f, _ := tree.FriendlyFit(10, 300, 50)
+	assert.Nil(t, f)
+
+	f, _ = tree.FriendlyFit(50, 130, 100)
+	assert.Nil(t, f)
+}
+
+func TestTraverseIn(t *testing.T) {
+	tree := New(100)
+	tree.Add(&Frame{Address: 200, Length: 80})
+	tree.Add(&Frame{Address: 500, Length: 300})
+	tree.Add(&Frame{Address: 1000, Length: 80})
+	tree.Add(&Frame{Address: 1500, Length: 200})
+	tree.Add(&Frame{Address: 2000, Length: 100})
+
+	nodes := make([]string, 0, 10)
+	tree.root.TraverseIn(func(f *Frame) error {
+		nodes = append(nodes, f.String())
+		return nil
+	})
+	result := strings.Join(nodes, "")
+	assert.Equal(t, "[0,100][200,80][500,300][1000,80][1500,200][2000,100]", result)
+}
+
+func TestTraverseInStop(t *testing.T) {
+	tree := New(100)
+	tree.Add(&Frame{Address: 200, Length: 80})
+	tree.Add(&Frame{Address: 500, Length: 300})
+
+	stop := errors.New("stop")
+	count := 0
+	err := tree.root.TraverseIn(func(f *Frame) error {
+		count++
+		if f.Address == 200 {
+			return stop
+		}
+		return nil
+	})
+
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 2, count)
+}
+
+func rangeOf(tree *CTree, lo, hi int32) string {
+	nodes := make([]string, 0, 10)
+	tree.Range(lo, hi, func(f *Frame) error {
+		nodes = append(nodes, f.String())
+		return nil
+	})
+	return strings.Join(nodes, "")
+}
+
+func TestRange(t *testing.T) {
+	tree := New(100)
+	tree.Add(&Frame{Address: 200, Length: 80})
+	tree.Add(&Frame{Address: 500, Length: 300})
+	tree.Add(&Frame{Address: 1000, Length: 80})
+	tree.Add(&Frame{Address: 1500, Length: 200})
+	tree.Add(&Frame{Address: 2000, Length: 100})
+
+	assert.Equal(t, "[0,100][200,80][500,300][1000,80][1500,200][2000,100]", rangeOf(tree, 0, 3000))
+	assert.Equal(t, "[200,80][500,300]", rangeOf(tree, 250, 501))
+	assert.Equal(t, "[500,300]", rangeOf(tree, 280, 800))
+	assert.Equal(t, "[0,100]", rangeOf(tree, 99, 100))
+	assert.Equal(t, "", rangeOf(tree, 100, 200))
+	assert.Equal(t, "", rangeOf(tree, 3000, 4000))
+	assert.Equal(t, "", rangeOf(&CTree{}, 0, 4000))
+}
+
+func TestRangeStop(t *testing.T) {
+	tree := New(100)
+	tree.Add(&Frame{Address: 200, Length: 80})
+	tree.Add(&Frame{Address: 500, Length: 300})
+	tree.Add(&Frame{Address: 1000, Length: 80})
+
+	stop := errors.New("stop")
+	count := 0
+	err := tree.Range(0, 2000, func(f *Frame) error {
+		count++
+		return stop
+	})
+
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestTraverseErrStop(t *testing.T) {
+	tree := New(100)
+	tree.Add(&Frame{Address: 200, Length: 80})
+	tree.Add(&Frame{Address: 500, Length: 300})
+
+	traversals := map[string]func(func(*Frame) error) error{
+		"pre":  tree.root.TraversePre,
+		"post": tree.root.TraversePost,
+		"in":   tree.root.TraverseIn,
+		"range": func(visit func(*Frame) error) error {
+			return tree.Range(0, 1000, visit)
+		},
+	}
+	for name, traverse := range traversals {
+		count := 0
+		err := traverse(func(f *Frame) error {
+			count++
+			return ErrStop
+		})
+		assert.NoError(t, err, name)
+		assert.Equal(t, 1, count, name)
+	}
+}
+
+func TestTree64(t *testing.T) {
+	tree := New64(1 << 40)
+	tree.Add(&Frame64{Address: 1<<41 + 10, Length: 1 << 35})
+	tree.Add(&Frame64{Address: 1 << 42, Length: 1 << 36})
+
+	assert.Equal(t, "[2199023255562,34359738368]", tree.BetterFit(1<<34).String())
+	f, addr := tree.FriendlyFit(100, 1<<42+1<<20, 1<<30)
+	assert.Equal(t, "[4398046511104,68719476736]", f.String())
+	assert.Equal(t, int64(1<<42+1<<20), addr)
+	assert.NoError(t, tree.Validate())
+}
+
+func TestRangeNoOverflow(t *testing.T) {
+	tree := New(100)
+	tree.Add(NewFrame(math.MaxInt32-100, 100))
+
+	assert.Equal(t, "[2147483547,100]", rangeOf(tree, math.MaxInt32-1, math.MaxInt32))
+	assert.Equal(t, "", rangeOf(tree, 100, math.MaxInt32-100))
+}
+
+// benchmarkSizes are the numbers of free Frames of the trees used by the
+// benchmarks of single operations.
+var benchmarkSizes = []int{1e3, 1e4, 1e5, 1e6}
+
+// benchmarkOp measures op on trees with the Frames of benchFrames. The tree
+// is rebuilt, without measuring it, when op returns true.
+func benchmarkOp(b *testing.B, op func(tree *CTree, frames []Frame, i int) bool) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			frames := benchFrames(n)
+			pointers := make([]*Frame, n)
+			build := func() *CTree {
+				for i := range frames {
+					pointers[i] = &Frame{Address: int32(i) * 100, Length: frames[i].Length}
+				}
+				tree, _ := Build(pointers)
+				return tree
+			}
+			tree := build()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if op(tree, frames, i%n) {
+					b.StopTimer()
+					tree = build()
+					b.StartTimer()
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCTreeAdd(b *testing.B) {
+	benchmarkOp(b, func(tree *CTree, frames []Frame, i int) bool {
+		// the last slot before each Frame of the tree is always free
+		tree.Add(&Frame{Address: int32(i)*100 + 99, Length: 1})
+		return i == len(frames)-1
+	})
+}
+
+func BenchmarkCTreeRemove(b *testing.B) {
+	benchmarkOp(b, func(tree *CTree, frames []Frame, i int) bool {
+		tree.RemoveAt(int32(i) * 100)
+		return i == len(frames)-1
+	})
+}
+
+func BenchmarkCTreeBetterFit(b *testing.B) {
+	benchmarkOp(b, func(tree *CTree, frames []Frame, i int) bool {
+		tree.BetterFit(frames[i].Length)
+		return false
+	})
+}
+
+func BenchmarkCTreeFriendlyFit(b *testing.B) {
+	benchmarkOp(b, func(tree *CTree, frames []Frame, i int) bool {
+		tree.FriendlyFit(frames[i].Length, frames[(i+1)%len(frames)].Address, 1600)
+		return false
+	})
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+// This file contains a pull style iterator over the Frames of the tree
+
+package ctree
+
+// Cursor iterates over the Frames of a tree by increasing address.
+// It is used like bufio.Scanner:
+//
+//	c := tree.Cursor()
+//	for c.Next() {
+//		f := c.Frame()
+//		...
+//	}
+//
+// The tree must not be modified while a Cursor is in use.
+type Cursor[T Integer] struct {
+	s       *stack[T]
+	current *FrameOf[T]
+}
+
+// Cursor returns a new Cursor positioned before the first Frame of the tree.
+func (t *CTreeOf[T]) Cursor() *Cursor[T] {
+	c := &Cursor[T]{s: newStack[T]()}
+	c.descend(t.root)
+	return c
+}
+
+// descend pushes f and its leftmost descendants on the stack.
+func (c *Cursor[T]) descend(f *FrameOf[T]) {
+	for f != nil {
+		c.s.push(f)
+		f = f.left
+	}
+}
+
+// Next advances the Cursor to the next Frame. It returns false when there
+// are no more Frames.
+func (c *Cursor[T]) Next() bool {
+	f, err := c.s.pop()
+	if err != nil {
+		c.current = nil
+		return false
+	}
+	c.descend(f.right)
+	c.current = f
+	return true
+}
+
+// Frame returns the Frame at the current position of the Cursor, or nil
+// before the first call to Next and after the iteration is over.
+func (c *Cursor[T]) Frame() *FrameOf[T] {
+	return c.current
+}
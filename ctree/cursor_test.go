@@ -0,0 +1,48 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package ctree
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursor(t *testing.T) {
+	tree := newRenderTree()
+
+	c := tree.Cursor()
+	assert.Nil(t, c.Frame())
+
+	nodes := make([]string, 0, 10)
+	for c.Next() {
+		nodes = append(nodes, c.Frame().String())
+	}
+	result := strings.Join(nodes, "")
+	assert.Equal(t, "[0,100][200,80][500,300][1000,80][1500,200][2000,100]", result)
+
+	assert.Nil(t, c.Frame())
+	assert.False(t, c.Next())
+}
+
+func TestCursorEmpty(t *testing.T) {
+	c := (&CTree{}).Cursor()
+
+	assert.False(t, c.Next())
+	assert.Nil(t, c.Frame())
+}
+
+func TestCursorInterleaved(t *testing.T) {
+	tree := newRenderTree()
+	a, b := tree.Cursor(), tree.Cursor()
+
+	a.Next()
+	a.Next()
+	b.Next()
+
+	assert.Equal(t, "[200,80]", a.Frame().String())
+	assert.Equal(t, "[0,100]", b.Frame().String())
+}
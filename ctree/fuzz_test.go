@@ -0,0 +1,255 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package ctree
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+// fuzzSize is the size of the memory used by the fuzz targets. It is small
+// so that random operations often hit the same Frames.
+const fuzzSize = 1 << 12
+
+// model is a trivially correct reference for the tree: the free Frames
+// sorted by address. All computations are done with 64 bit integers.
+type model []Frame64
+
+// find returns the index of the first Frame whose address is larger than
+// address.
+func (m model) find(address int64) int {
+	return sort.Search(len(m), func(i int) bool { return m[i].Address > address })
+}
+
+// overlaps tells if f overlaps one of the Frames of the model.
+func (m model) overlaps(f Frame64) bool {
+	for _, g := range m {
+		if f.Address < g.Address+g.Length && g.Address < f.Address+f.Length {
+			return true
+		}
+	}
+	return false
+}
+
+// add inserts f in the model without merging it with its neighbours.
+func (m *model) add(f Frame64) {
+	i := m.find(f.Address)
+	*m = append(*m, Frame64{})
+	copy((*m)[i+1:], (*m)[i:])
+	(*m)[i] = f
+}
+
+// remove takes out the Frame at index i.
+func (m *model) remove(i int) Frame64 {
+	f := (*m)[i]
+	*m = append((*m)[:i], (*m)[i+1:]...)
+	return f
+}
+
+// coalesce inserts f in the model merging it with the Frames it touches.
+func (m *model) coalesce(f Frame64) Frame64 {
+	i := m.find(f.Address)
+	if i < len(*m) && f.Address+f.Length == (*m)[i].Address {
+		f.Length += m.remove(i).Length
+	}
+	if i > 0 && (*m)[i-1].Address+(*m)[i-1].Length == f.Address {
+		p := m.remove(i - 1)
+		f.Address, f.Length = p.Address, p.Length+f.Length
+	}
+	m.add(f)
+	return f
+}
+
+// betterFit returns the index of the smallest Frame of at least size slots
+// with the lowest address, or -1.
+func (m model) betterFit(size int64) int {
+	best := -1
+	for i, f := range m {
+		if f.Length >= size && (best < 0 || f.Length < m[best].Length) {
+			best = i
+		}
+	}
+	return best
+}
+
+// friendlyFit returns the index of the Frame that can hold a block of the
+// given size nearest to pref, and the address of the block, or -1.
+func (m model) friendlyFit(size, pref, tol int64) (int, int64) {
+	best, bestAddr, bestDist := -1, int64(0), int64(0)
+	for i, f := range m {
+		if f.Length < size {
+			continue
+		}
+		addr := pref
+		if addr > f.Address+f.Length-size {
+			addr = f.Address + f.Length - size
+		}
+		if addr < f.Address {
+			addr = f.Address
+		}
+		dist := addr - pref
+		if dist < 0 {
+			dist = -dist
+		}
+		if dist <= tol && (best < 0 || dist < bestDist || (dist == bestDist && addr < bestAddr)) {
+			best, bestAddr, bestDist = i, addr, dist
+		}
+	}
+	return best, bestAddr
+}
+
+// free returns the total number of free slots.
+func (m model) free() (n int64) {
+	for _, f := range m {
+		n += f.Length
+	}
+	return
+}
+
+// fuzzOps decodes ops as a sequence of operations of three bytes each and
+// performs them both on a CTree and on the model, checking that they agree
+// after every step.
+func fuzzOps(t *testing.T, tree *CTree, ops []byte) {
+	var m model
+	tree.Range(0, fuzzSize, func(f *Frame) error {
+		m.add(widen(f))
+		return nil
+	})
+
+	for len(ops) >= 3 {
+		op, a, b := ops[0], int64(ops[1]), int64(ops[2])
+		ops = ops[3:]
+		length := b + 1
+		address := (a*fuzzSize/256 + b) % (fuzzSize - length)
+
+		var step string
+		switch op % 6 {
+		case 0: // plain add, only if it does not break the tree
+			f := Frame64{Address: address, Length: length}
+			step = fmt.Sprintf("add %v", f)
+			if !m.overlaps(f) {
+				tree.Add(&Frame{Address: int32(address), Length: int32(length)})
+				m.add(f)
+			}
+		case 1: // coalesce
+			f := Frame64{Address: address, Length: length}
+			step = fmt.Sprintf("coalesce %v", f)
+			got, err := tree.Coalesce(&Frame{Address: int32(address), Length: int32(length)})
+			if m.overlaps(f) {
+				if _, ok := err.(*OverlapError); !ok {
+					t.Fatalf("%s: got %v, want an overlap error", step, err)
+				}
+				break
+			}
+			want := m.coalesce(f)
+			if err != nil || widen(got) != want {
+				t.Fatalf("%s: got %v %v, want %v", step, got, err, want)
+			}
+		case 2: // remove an existing Frame
+			if len(m) == 0 {
+				continue
+			}
+			want := m.remove(int(a) % len(m))
+			step = fmt.Sprintf("remove at %d", want.Address)
+			got, err := tree.RemoveAt(int32(want.Address))
+			if err != nil || widen(got) != want {
+				t.Fatalf("%s: got %v %v, want %v", step, got, err, want)
+			}
+		case 3: // remove a missing Frame
+			step = fmt.Sprintf("remove at %d", address)
+			if i := m.find(address); i > 0 && m[i-1].Address == address {
+				continue
+			}
+			if _, err := tree.RemoveAt(int32(address)); err != ErrFrameNotFound {
+				t.Fatalf("%s: got %v, want %v", step, err, ErrFrameNotFound)
+			}
+		case 4: // allocate with better fit
+			size := a + 1
+			step = fmt.Sprintf("better fit %d", size)
+			got := tree.BetterFit(int32(size))
+			i := m.betterFit(size)
+			if i < 0 {
+				if got != nil {
+					t.Fatalf("%s: got %v, want nil", step, got)
+				}
+				break
+			}
+			if got == nil || widen(got) != m[i] {
+				t.Fatalf("%s: got %v, want %v", step, got, m[i])
+			}
+			f := m.remove(i)
+			tree.Remove(got)
+			if f.Length > size {
+				m.add(Frame64{Address: f.Address + size, Length: f.Length - size})
+				tree.Add(&Frame{Address: int32(f.Address + size), Length: int32(f.Length - size)})
+			}
+		case 5: // allocate with friendly fit
+			size, pref, tol := b+1, address, a
+			step = fmt.Sprintf("friendly fit %d at %d±%d", size, pref, tol)
+			got, addr := tree.FriendlyFit(int32(size), int32(pref), int32(tol))
+			i, want := m.friendlyFit(size, pref, tol)
+			if i < 0 {
+				if got != nil {
+					t.Fatalf("%s: got %v at %d, want nil", step, got, addr)
+				}
+				break
+			}
+			if got == nil || widen(got) != m[i] || int64(addr) != want {
+				t.Fatalf("%s: got %v at %d, want %v at %d", step, got, addr, m[i], want)
+			}
+			f := m.remove(i)
+			tree.Remove(got)
+			if want > f.Address {
+				m.add(Frame64{Address: f.Address, Length: want - f.Address})
+				tree.Add(&Frame{Address: int32(f.Address), Length: int32(want - f.Address)})
+			}
+			if rest := f.Address + f.Length - want - size; rest > 0 {
+				m.add(Frame64{Address: want + size, Length: rest})
+				tree.Add(&Frame{Address: int32(want + size), Length: int32(rest)})
+			}
+		}
+
+		if err := tree.Validate(); err != nil {
+			t.Fatalf("%s: %v", step, err)
+		}
+		if tree.Frames != len(m) {
+			t.Fatalf("%s: %d frames, want %d", step, tree.Frames, len(m))
+		}
+		if s := tree.Stats(); s.Free != m.free() {
+			t.Fatalf("%s: %d free slots, want %d", step, s.Free, m.free())
+		}
+		i := 0
+		tree.Range(0, fuzzSize, func(f *Frame) error {
+			if i >= len(m) || widen(f) != m[i] {
+				t.Fatalf("%s: frame %d is %v, want %v", step, i, f, m)
+			}
+			i++
+			return nil
+		})
+	}
+}
+
+// FuzzCTree checks random sequences of operations on a tree that starts
+// with all the memory free.
+func FuzzCTree(f *testing.F) {
+	f.Add([]byte{4, 9, 0, 4, 200, 0, 2, 0, 0})
+	f.Add([]byte{5, 10, 20, 5, 128, 7, 1, 10, 20, 1, 128, 7})
+	f.Add([]byte{4, 255, 0, 4, 255, 0, 4, 255, 0, 1, 0, 255, 1, 64, 255, 3, 30, 1})
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		fuzzOps(t, New(fuzzSize), ops)
+	})
+}
+
+// FuzzFrameAdd checks random sequences of operations on a tree built from
+// scattered Frames, so that Frame.Add and Frame.append reshape deep subtrees.
+func FuzzFrameAdd(f *testing.F) {
+	f.Add([]byte{0, 10, 5, 0, 20, 50, 0, 30, 5, 0, 5, 100})
+	f.Add([]byte{0, 1, 1, 0, 2, 2, 0, 3, 3, 0, 4, 4, 0, 5, 5, 2, 3, 0})
+	f.Add([]byte{0, 250, 1, 0, 200, 9, 0, 150, 90, 4, 9, 0, 5, 100, 30})
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		fuzzOps(t, &CTree{}, ops)
+	})
+}
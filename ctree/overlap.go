@@ -6,6 +6,16 @@
 
 package ctree
 
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidFrame is the cause of the errors returned when coalescing a
+// Frame with a negative address or length.
+var ErrInvalidFrame = errors.New("invalid frame")
+
 const (
 	right = iota
 	left
@@ -16,21 +26,113 @@ const (
 
 // position returns a value that encodes the relative position of "other"
 // with respect to "f".
-func (f *Frame) position(other *Frame) int {
+// The ends of the Frames are not computed because the sum of address and
+// length can overflow. The gaps between the addresses are used instead.
+func (f *FrameOf[T]) position(other *FrameOf[T]) int {
 
-	end := f.Address + f.Length
-	otherEnd := other.Address + other.Length
+	after := other.Address >= f.Address
+	before := other.Address <= f.Address
 
 	switch {
-	case other.Address > end:
+	case after && other.Address-f.Address > f.Length:
 		return right
-	case otherEnd < f.Address:
+	case before && f.Address-other.Address > other.Length:
 		return left
-	case other.Address == end:
+	case after && other.Address-f.Address == f.Length:
 		return touchRight
-	case otherEnd == f.Address:
+	case before && f.Address-other.Address == other.Length:
 		return touchLeft
 	default:
 		return overlaps
 	}
 }
+
+// OverlapError is returned when a Frame that is being returned to the tree
+// overlaps one of the free Frames already in it.
+// Frames of all trees are reported with 64 bit addresses.
+type OverlapError struct {
+	Frame Frame64
+	Free  Frame64
+}
+
+// newOverlapError returns an OverlapError with detached copies of the Frames.
+func newOverlapError[T Integer](f, free *FrameOf[T]) *OverlapError {
+	return &OverlapError{
+		Frame: widen(f),
+		Free:  widen(free),
+	}
+}
+
+func (e *OverlapError) Error() string {
+	return fmt.Sprintf("frame %v overlaps free frame %v", e.Frame, e.Free)
+}
+
+// Neighbours returns the Frames immediately before and after the given
+// address: prev is the last Frame starting at or before address and next
+// the first one starting after it. Either of them can be nil.
+func (t *CTreeOf[T]) Neighbours(address T) (prev, next *FrameOf[T]) {
+	current := t.root
+	for current != nil {
+		if address < current.Address {
+			next = current
+			current = current.left
+		} else {
+			prev = current
+			current = current.right
+		}
+	}
+	return
+}
+
+// Joins tells if f must be merged with the free Frames prev and next that
+// surround it. Either of them can be nil. An *OverlapError is returned if
+// f overlaps one of them.
+// The position of the Frames is computed from the differences of their
+// addresses, which can not overflow only if they are not negative: Frames
+// with a negative address or length are rejected with ErrInvalidFrame.
+func (f *FrameOf[T]) Joins(prev, next *FrameOf[T]) (joinPrev, joinNext bool, err error) {
+	if f.Address < 0 || f.Length < 0 {
+		return false, false, errors.Wrapf(ErrInvalidFrame, "frame %v", f)
+	}
+	if prev != nil {
+		switch f.position(prev) {
+		case overlaps:
+			return false, false, newOverlapError(f, prev)
+		case touchLeft:
+			joinPrev = true
+		}
+	}
+	if next != nil {
+		switch f.position(next) {
+		case overlaps:
+			return false, false, newOverlapError(f, next)
+		case touchRight:
+			joinNext = true
+		}
+	}
+	return
+}
+
+// Coalesce adds nf to the tree merging it with the free Frames it touches on
+// either side. The Frame that ends up in the tree is returned.
+// If nf overlaps a free Frame the tree is not modified and an *OverlapError
+// is returned.
+func (t *CTreeOf[T]) Coalesce(nf *FrameOf[T]) (*FrameOf[T], error) {
+	prev, next := t.Neighbours(nf.Address)
+	joinPrev, joinNext, err := nf.Joins(prev, next)
+	if err != nil {
+		return nil, err
+	}
+
+	if joinPrev {
+		t.Remove(prev)
+		prev.Length += nf.Length
+		nf = prev
+	}
+	if joinNext {
+		t.Remove(next)
+		nf.Length += next.Length
+	}
+	t.Add(nf)
+	return nf, nil
+}
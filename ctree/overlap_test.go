@@ -4,7 +4,13 @@
 
 package ctree
 
-import "testing"
+import (
+	"math"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
 
 var (
 	names = map[int]string{
@@ -92,3 +98,108 @@ func TestPositionOverlapsFully(t *testing.T) {
 		t.Errorf("Expected \"Overlaps\", but was %v instead.", names[res])
 	}
 }
+
+func TestCoalesceIsolated(t *testing.T) {
+	tree := New(100)
+	tree.Add(&Frame{500, 100, nil, nil})
+
+	f, err := tree.Coalesce(&Frame{300, 50, nil, nil})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "[300,50]", f.String())
+	assert.Equal(t, 3, tree.Frames)
+}
+
+func TestCoalesceLeft(t *testing.T) {
+	tree := New(100)
+	tree.Add(&Frame{500, 100, nil, nil})
+
+	f, err := tree.Coalesce(&Frame{100, 50, nil, nil})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "[0,150]", f.String())
+	assert.Equal(t, 2, tree.Frames)
+}
+
+func TestCoalesceRight(t *testing.T) {
+	tree := New(100)
+	tree.Add(&Frame{500, 100, nil, nil})
+
+	f, err := tree.Coalesce(&Frame{450, 50, nil, nil})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "[450,150]", f.String())
+	assert.Equal(t, 2, tree.Frames)
+}
+
+func TestCoalesceBoth(t *testing.T) {
+	tree := New(100)
+	tree.Add(&Frame{500, 100, nil, nil})
+	tree.Add(&Frame{800, 10, nil, nil})
+
+	f, err := tree.Coalesce(&Frame{100, 400, nil, nil})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "[0,600]", f.String())
+	assert.Equal(t, 2, tree.Frames)
+	assert.Equal(t, f, tree.BetterFit(600))
+}
+
+func TestCoalesceOverlap(t *testing.T) {
+	tree := New(100)
+	tree.Add(&Frame{500, 100, nil, nil})
+
+	_, err := tree.Coalesce(&Frame{450, 60, nil, nil})
+
+	if assert.Error(t, err) {
+		assert.EqualError(t, err, "frame [450,60] overlaps free frame [500,100]")
+		assert.Equal(t, 2, tree.Frames)
+	}
+
+	_, err = tree.Coalesce(&Frame{50, 10, nil, nil})
+	assert.IsType(t, &OverlapError{}, err)
+}
+
+func TestCoalesceNegative(t *testing.T) {
+	tree := New(100)
+	tree.Add(&Frame{math.MaxInt32 - 10, 10, nil, nil})
+
+	_, err := tree.Coalesce(&Frame{-math.MaxInt32 + 10, 10, nil, nil})
+	assert.Equal(t, ErrInvalidFrame, errors.Cause(err))
+	_, err = tree.Coalesce(&Frame{200, -10, nil, nil})
+	assert.Equal(t, ErrInvalidFrame, errors.Cause(err))
+	assert.Equal(t, 2, tree.Frames)
+
+	_, err = NewArena(100).Coalesce(Frame{-10, 10, nil, nil})
+	assert.Equal(t, ErrInvalidFrame, errors.Cause(err))
+}
+
+func TestPositionNoOverflow(t *testing.T) {
+	t.Log("Frames at the end of the address space")
+
+	this := &Frame{math.MaxInt32 - 100, 100, nil, nil}
+	other := &Frame{math.MaxInt32 - 200, 100, nil, nil}
+
+	if res := this.position(other); res != touchLeft {
+		t.Errorf("Expected \"TouchLeft\", but was %v instead.", names[res])
+	}
+	if res := other.position(this); res != touchRight {
+		t.Errorf("Expected \"TouchRight\", but was %v instead.", names[res])
+	}
+
+	other = &Frame{math.MaxInt32 - 50, 50, nil, nil}
+	if res := this.position(other); res != overlaps {
+		t.Errorf("Expected \"Overlaps\", but was %v instead.", names[res])
+	}
+}
+
+func TestCoalesce64(t *testing.T) {
+	tree := New64(1 << 33)
+	tree.Add(&Frame64{Address: 1<<34 + 100, Length: 1 << 32})
+
+	f, err := tree.Coalesce(&Frame64{Address: 1 << 33, Length: 1<<34 - 1<<33 + 100})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "[0,21474836580]", f.String())
+	assert.Equal(t, 1, tree.Frames)
+}
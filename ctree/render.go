@@ -0,0 +1,103 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+// This file contains code for rendering the tree in human readable formats
+
+package ctree
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// WriteDot writes the tree to w in the Graphviz DOT language.
+// Nodes are labeled with address and length of their Frame. Edges to left
+// children are solid, edges to right children are dashed.
+func (t *CTreeOf[T]) WriteDot(w io.Writer) error {
+	var buf bytes.Buffer
+	buf.WriteString("digraph ctree {\n")
+	buf.WriteString("\tnode [shape=record];\n")
+
+	if t.root != nil {
+		ids := make(map[*FrameOf[T]]int, t.Frames)
+		t.root.TraversePre(func(f *FrameOf[T]) error {
+			id := len(ids)
+			ids[f] = id
+			fmt.Fprintf(&buf, "\tf%d [label=\"{%d|%d}\"];\n", id, f.Address, f.Length)
+			return nil
+		})
+		t.root.TraversePre(func(f *FrameOf[T]) error {
+			if f.left != nil {
+				fmt.Fprintf(&buf, "\tf%d -> f%d [style=solid];\n", ids[f], ids[f.left])
+			}
+			if f.right != nil {
+				fmt.Fprintf(&buf, "\tf%d -> f%d [style=dashed];\n", ids[f], ids[f.right])
+			}
+			return nil
+		})
+	}
+
+	buf.WriteString("}\n")
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// Dot returns the tree in the Graphviz DOT language. See WriteDot.
+func (t *CTreeOf[T]) Dot() string {
+	var buf bytes.Buffer
+	t.WriteDot(&buf)
+	return buf.String()
+}
+
+// line is a Frame waiting to be printed by WriteASCII.
+type line[T Integer] struct {
+	f      *FrameOf[T]
+	side   string // "L" or "R", empty for the root
+	prefix string // indentation inherited from the parent
+	last   bool   // last child of its parent
+}
+
+// WriteASCII writes to w a compact drawing of the tree, one Frame per line.
+// Children are marked with L or R depending on their side.
+func (t *CTreeOf[T]) WriteASCII(w io.Writer) error {
+	var buf bytes.Buffer
+	if t.root == nil {
+		buf.WriteString("(empty)\n")
+	} else {
+		todo := []line[T]{{f: t.root}}
+		for len(todo) > 0 {
+			l := todo[len(todo)-1]
+			todo = todo[:len(todo)-1]
+
+			childPrefix := l.prefix
+			if l.side == "" {
+				fmt.Fprintf(&buf, "%v\n", l.f)
+			} else if l.last {
+				fmt.Fprintf(&buf, "%s└── %s %v\n", l.prefix, l.side, l.f)
+				childPrefix += "    "
+			} else {
+				fmt.Fprintf(&buf, "%s├── %s %v\n", l.prefix, l.side, l.f)
+				childPrefix += "│   "
+			}
+
+			// pushed in reverse order
+			if l.f.right != nil {
+				todo = append(todo, line[T]{l.f.right, "R", childPrefix, true})
+			}
+			if l.f.left != nil {
+				todo = append(todo, line[T]{l.f.left, "L", childPrefix, l.f.right == nil})
+			}
+		}
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// ASCII returns a compact drawing of the tree. See WriteASCII.
+func (t *CTreeOf[T]) ASCII() string {
+	var buf bytes.Buffer
+	t.WriteASCII(&buf)
+	return buf.String()
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package ctree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newRenderTree() *CTree {
+	tree := New(100)
+	tree.Add(&Frame{Address: 200, Length: 80})
+	tree.Add(&Frame{Address: 500, Length: 300})
+	tree.Add(&Frame{Address: 1000, Length: 80})
+	tree.Add(&Frame{Address: 1500, Length: 200})
+	tree.Add(&Frame{Address: 2000, Length: 100})
+	return tree
+}
+
+func TestDot(t *testing.T) {
+	expected := `digraph ctree {
+	node [shape=record];
+	f0 [label="{500|300}"];
+	f1 [label="{0|100}"];
+	f2 [label="{200|80}"];
+	f3 [label="{1500|200}"];
+	f4 [label="{1000|80}"];
+	f5 [label="{2000|100}"];
+	f0 -> f1 [style=solid];
+	f0 -> f3 [style=dashed];
+	f1 -> f2 [style=dashed];
+	f3 -> f4 [style=solid];
+	f3 -> f5 [style=dashed];
+}
+`
+	assert.Equal(t, expected, newRenderTree().Dot())
+}
+
+func TestDotEmpty(t *testing.T) {
+	assert.Equal(t, "digraph ctree {\n\tnode [shape=record];\n}\n", (&CTree{}).Dot())
+}
+
+func TestASCII(t *testing.T) {
+	expected := `[500,300]
+├── L [0,100]
+│   └── R [200,80]
+└── R [1500,200]
+    ├── L [1000,80]
+    └── R [2000,100]
+`
+	assert.Equal(t, expected, newRenderTree().ASCII())
+}
+
+func TestASCIIEmpty(t *testing.T) {
+	assert.Equal(t, "(empty)\n", (&CTree{}).ASCII())
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+// This file contains code for saving the tree and loading it back
+
+package ctree
+
+import (
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// Binary snapshots start with a header made of the magic string, the format
+// version and the size in bytes of the integers of the tree. It is followed
+// by the number of Frames and by the Frames in pre-order. Each Frame is
+// stored as a byte of flags telling which children it has, followed by its
+// address and length. All numbers are varints.
+const (
+	snapshotMagic   = "CTRE"
+	snapshotVersion = 1
+)
+
+// Flags of the Frames in a snapshot.
+const (
+	hasLeft byte = 1 << iota
+	hasRight
+)
+
+// ErrSnapshot is the cause of all errors returned while loading a snapshot.
+var ErrSnapshot = errors.New("invalid snapshot")
+
+// record is a Frame in a snapshot.
+type record struct {
+	Address int64 `json:"address"`
+	Length  int64 `json:"length"`
+	Left    bool  `json:"left,omitempty"`
+	Right   bool  `json:"right,omitempty"`
+}
+
+// jsonSnapshot is the JSON form of a snapshot.
+type jsonSnapshot struct {
+	Version int      `json:"version"`
+	Frames  []record `json:"frames"`
+}
+
+// records returns the Frames of the tree in pre-order.
+func (t *CTreeOf[T]) records() []record {
+	records := make([]record, 0, t.Frames)
+	if t.root != nil {
+		t.root.TraversePre(func(f *FrameOf[T]) error {
+			records = append(records, record{
+				Address: int64(f.Address),
+				Length:  int64(f.Length),
+				Left:    f.left != nil,
+				Right:   f.right != nil,
+			})
+			return nil
+		})
+	}
+	return records
+}
+
+// load replaces the content of the tree with the Frames in records. The new
+// tree has exactly the same structure of the saved one. If the records do not
+// describe a valid tree, the tree is not modified.
+func (t *CTreeOf[T]) load(records []record) error {
+	var root *FrameOf[T]
+	link := &root
+	var pending []*FrameOf[T] // Frames waiting for their right child
+
+	for _, r := range records {
+		if link == nil {
+			return errors.Wrap(ErrSnapshot, "too many frames")
+		}
+		f := &FrameOf[T]{Address: T(r.Address), Length: T(r.Length)}
+		if int64(f.Address) != r.Address || int64(f.Length) != r.Length {
+			return errors.Wrapf(ErrSnapshot, "frame [%d,%d] does not fit the tree", r.Address, r.Length)
+		}
+		*link = f
+
+		if r.Right {
+			pending = append(pending, f)
+		}
+		switch {
+		case r.Left:
+			link = &f.left
+		case len(pending) > 0:
+			link = &pending[len(pending)-1].right
+			pending = pending[:len(pending)-1]
+		default:
+			link = nil
+		}
+	}
+	if link != nil && len(records) > 0 {
+		return errors.Wrap(ErrSnapshot, "missing frames")
+	}
+
+	loaded := &CTreeOf[T]{root: root, Frames: len(records)}
+	if err := loaded.Validate(); err != nil {
+		return errors.Wrap(ErrSnapshot, err.Error())
+	}
+	*t = *loaded
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (t *CTreeOf[T]) MarshalBinary() ([]byte, error) {
+	records := t.records()
+
+	buf := make([]byte, 0, len(snapshotMagic)+2+binary.MaxVarintLen64*(1+2*len(records))+len(records))
+	buf = append(buf, snapshotMagic...)
+	buf = append(buf, snapshotVersion, intSize[T]())
+	buf = binary.AppendUvarint(buf, uint64(len(records)))
+	for _, r := range records {
+		var flags byte
+		if r.Left {
+			flags |= hasLeft
+		}
+		if r.Right {
+			flags |= hasRight
+		}
+		buf = append(buf, flags)
+		buf = binary.AppendVarint(buf, r.Address)
+		buf = binary.AppendVarint(buf, r.Length)
+	}
+	return buf, nil
+}
+
+// intSize returns the size in bytes of the integers of type T, found by
+// doubling a single bit until it overflows.
+func intSize[T Integer]() byte {
+	bits := 0
+	for x := T(1); x != 0; x += x {
+		bits++
+	}
+	return byte(bits / 8)
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. Snapshots taken
+// from trees with larger integers can be loaded as long as all addresses
+// and lengths fit.
+func (t *CTreeOf[T]) UnmarshalBinary(data []byte) error {
+	header := len(snapshotMagic) + 2
+	if len(data) < header || string(data[:len(snapshotMagic)]) != snapshotMagic {
+		return errors.Wrap(ErrSnapshot, "bad header")
+	}
+	if v := data[len(snapshotMagic)]; v != snapshotVersion {
+		return errors.Wrapf(ErrSnapshot, "unsupported version %d", v)
+	}
+	if w := data[len(snapshotMagic)+1]; w == 0 || w > 8 {
+		return errors.Wrapf(ErrSnapshot, "bad integer size %d", w)
+	}
+	data = data[header:]
+
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return errors.Wrap(ErrSnapshot, "bad frame count")
+	}
+	data = data[n:]
+
+	// each Frame takes at least three bytes
+	if count > uint64(len(data)/3) {
+		return errors.Wrap(ErrSnapshot, "truncated data")
+	}
+	records := make([]record, count)
+	for i := range records {
+		if len(data) == 0 {
+			return errors.Wrap(ErrSnapshot, "truncated data")
+		}
+		flags := data[0]
+		data = data[1:]
+		r := &records[i]
+		r.Left, r.Right = flags&hasLeft != 0, flags&hasRight != 0
+		for _, v := range []*int64{&r.Address, &r.Length} {
+			if *v, n = binary.Varint(data); n <= 0 {
+				return errors.Wrap(ErrSnapshot, "truncated data")
+			}
+			data = data[n:]
+		}
+	}
+	if len(data) > 0 {
+		return errors.Wrap(ErrSnapshot, "trailing data")
+	}
+	return t.load(records)
+}
+
+// MarshalJSON implements json.Marshaler. The JSON form contains the same
+// information of the binary one and is meant for inspection.
+func (t *CTreeOf[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonSnapshot{
+		Version: snapshotVersion,
+		Frames:  t.records(),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *CTreeOf[T]) UnmarshalJSON(data []byte) error {
+	var s jsonSnapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.Wrap(ErrSnapshot, err.Error())
+	}
+	if s.Version != snapshotVersion {
+		return errors.Wrapf(ErrSnapshot, "unsupported version %d", s.Version)
+	}
+	return t.load(s.Frames)
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package ctree
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBinaryRoundTrip(t *testing.T) {
+	tree := newValidTree()
+
+	data, err := tree.MarshalBinary()
+	if assert.NoError(t, err) {
+		loaded := &CTree{}
+		if assert.NoError(t, loaded.UnmarshalBinary(data)) {
+			assert.Equal(t, tree.Frames, loaded.Frames)
+			assert.Equal(t, preOrder(tree), preOrder(loaded))
+			assert.Equal(t, tree.ASCII(), loaded.ASCII())
+		}
+	}
+}
+
+func TestBinaryEmpty(t *testing.T) {
+	data, err := (&CTree{}).MarshalBinary()
+	if assert.NoError(t, err) {
+		loaded := New(100)
+		if assert.NoError(t, loaded.UnmarshalBinary(data)) {
+			assert.Equal(t, 0, loaded.Frames)
+			assert.Nil(t, loaded.root)
+		}
+	}
+}
+
+func TestIntSize(t *testing.T) {
+	assert.Equal(t, byte(1), intSize[int8]())
+	assert.Equal(t, byte(2), intSize[int16]())
+	assert.Equal(t, byte(4), intSize[int32]())
+	assert.Equal(t, byte(8), intSize[int64]())
+
+	data, _ := New64(100).MarshalBinary()
+	assert.Equal(t, byte(8), data[len(snapshotMagic)+1])
+}
+
+func TestBinaryWiden(t *testing.T) {
+	tree := newValidTree()
+	data, _ := tree.MarshalBinary()
+
+	loaded := &CTree64{}
+	if assert.NoError(t, loaded.UnmarshalBinary(data)) {
+		assert.Equal(t, tree.ASCII(), loaded.ASCII())
+	}
+}
+
+func TestBinaryNarrow(t *testing.T) {
+	data, _ := New64(1 << 40).MarshalBinary()
+
+	err := New(10).UnmarshalBinary(data)
+
+	assert.Equal(t, ErrSnapshot, errors.Cause(err))
+}
+
+func TestBinaryCorrupt(t *testing.T) {
+	data, _ := newValidTree().MarshalBinary()
+	tree := New(10)
+
+	corrupt := func(f func([]byte) []byte) error {
+		d := append([]byte(nil), data...)
+		return tree.UnmarshalBinary(f(d))
+	}
+
+	for name, f := range map[string]func([]byte) []byte{
+		"magic":     func(d []byte) []byte { d[0] = 'X'; return d },
+		"version":   func(d []byte) []byte { d[4] = 2; return d },
+		"truncated": func(d []byte) []byte { return d[:len(d)-1] },
+		"trailing":  func(d []byte) []byte { return append(d, 0) },
+		"structure": func(d []byte) []byte { d[7] ^= hasRight; return d },
+		"order":     func(d []byte) []byte { d[9] = 200; return d },
+	} {
+		err := corrupt(f)
+		assert.Equal(t, ErrSnapshot, errors.Cause(err), name)
+	}
+	// a failed load leaves the tree untouched
+	assert.Equal(t, "[0,10]", preOrder(tree))
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	tree := New(100)
+	tree.Add(NewFrame(200, 80))
+	tree.Add(NewFrame(500, 300))
+
+	data, err := json.Marshal(tree)
+	if assert.NoError(t, err) {
+		assert.Equal(t, `{"version":1,"frames":[{"address":500,"length":300,"left":true},`+
+			`{"address":0,"length":100,"right":true},{"address":200,"length":80}]}`, string(data))
+
+		loaded := &CTree{}
+		if assert.NoError(t, json.Unmarshal(data, loaded)) {
+			assert.Equal(t, preOrder(tree), preOrder(loaded))
+		}
+	}
+}
+
+func TestJSONInvalid(t *testing.T) {
+	tree := &CTree{}
+
+	err := json.Unmarshal([]byte(`{"version":1,"frames":[{"address":0,"length":10,"left":true},{"address":5,"length":20}]}`), tree)
+
+	assert.Equal(t, ErrSnapshot, errors.Cause(err))
+}
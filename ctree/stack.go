@@ -16,41 +16,41 @@ var errEmptyStack = errors.New("Illegal operation: stack is empty")
 const blockSize = 64
 
 // stack is a last-in-first-out (LIFO) stack of pointers to Frames.
-type stack struct {
-	frames  []*Frame
+type stack[T Integer] struct {
+	frames  []*FrameOf[T]
 	current int
 }
 
 // newStack returns a new empty stack of default size (depth)
-func newStack() *stack {
-	s := new(stack)
-	s.frames = make([]*Frame, blockSize)
+func newStack[T Integer]() *stack[T] {
+	s := new(stack[T])
+	s.frames = make([]*FrameOf[T], blockSize)
 	s.current = -1
 	return s
 }
 
 // newStackWith returns a new stack of default size (depth) with the
 // given item already at the top.
-func newStackWith(f *Frame) *stack {
-	s := newStack()
+func newStackWith[T Integer](f *FrameOf[T]) *stack[T] {
+	s := newStack[T]()
 	s.push(f)
 	return s
 }
 
 // push a Frame pointer onto the top of the stack.
-func (s *stack) push(f *Frame) {
+func (s *stack[T]) push(f *FrameOf[T]) {
 	s.current++
 	s.frames[s.current] = f
 
 	if s.current == len(s.frames)-1 {
-		newSlice := make([]*Frame, cap(s.frames)+blockSize)
+		newSlice := make([]*FrameOf[T], cap(s.frames)+blockSize)
 		copy(newSlice, s.frames)
 		s.frames = newSlice
 	}
 }
 
 // pop removes a Frame pointer from the top of the stack and returns it.
-func (s *stack) pop() (*Frame, error) {
+func (s *stack[T]) pop() (*FrameOf[T], error) {
 	if s.current < 0 {
 		return nil, errEmptyStack
 	}
@@ -60,7 +60,7 @@ func (s *stack) pop() (*Frame, error) {
 }
 
 // peek returns the Frame at the top of this stack without removing it.
-func (s *stack) peek() *Frame {
+func (s *stack[T]) peek() *FrameOf[T] {
 	if s.current < 0 {
 		return nil
 	}
@@ -68,11 +68,11 @@ func (s *stack) peek() *Frame {
 }
 
 // depth return the number of items currently in the stack.
-func (s stack) depth() int {
+func (s stack[T]) depth() int {
 	return s.current + 1
 }
 
 // empty tests if this stack is empty.
-func (s stack) empty() bool {
+func (s stack[T]) empty() bool {
 	return s.current == -1
 }
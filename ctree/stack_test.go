@@ -16,7 +16,7 @@ const (
 )
 
 func TestPopEmpty(t *testing.T) {
-	stack := newStack()
+	stack := newStack[int32]()
 
 	assert.True(t, stack.empty())
 
@@ -26,7 +26,7 @@ func TestPopEmpty(t *testing.T) {
 }
 
 func TestPushOne(t *testing.T) {
-	stack := newStack()
+	stack := newStack[int32]()
 
 	fp := &Frame{Address: 0, Length: 100}
 	stack.push(fp)
@@ -40,7 +40,7 @@ func TestPushOne(t *testing.T) {
 }
 
 func TestPushTwo(t *testing.T) {
-	stack := newStack()
+	stack := newStack[int32]()
 
 	fp1 := &Frame{Address: 0, Length: 100}
 	stack.push(fp1)
@@ -58,7 +58,7 @@ func TestPushTwo(t *testing.T) {
 }
 
 func TestAfterPop(t *testing.T) {
-	stack := newStack()
+	stack := newStack[int32]()
 
 	fp := &Frame{Address: 0, Length: 100}
 	stack.push(fp)
@@ -71,13 +71,13 @@ func TestAfterPop(t *testing.T) {
 }
 
 func TestPeekEmpty(t *testing.T) {
-	stack := newStack()
+	stack := newStack[int32]()
 
 	assert.Nil(t, stack.peek())
 }
 
 func TestPeek(t *testing.T) {
-	stack := newStack()
+	stack := newStack[int32]()
 
 	fp1 := &Frame{Address: 0, Length: 100}
 	stack.push(fp1)
@@ -0,0 +1,78 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+// This file contains code for computing statistics about the free memory
+
+package ctree
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+)
+
+// Stats contains statistics about the free Frames of a tree.
+type Stats struct {
+	Frames  int     // number of free Frames
+	Free    int64   // total free slots
+	Largest int64   // length of the largest Frame
+	Mean    float64 // mean length of the Frames
+	Median  float64 // median length of the Frames
+
+	// Histogram counts the Frames by size class: the Frames in class i have
+	// a length between 2^i and 2^(i+1)-1. Trailing empty classes are omitted.
+	Histogram []int
+
+	// Fragmentation is the external fragmentation: the fraction of free
+	// memory that is not in the largest Frame. It is 0 when all the free
+	// memory is in a single Frame and approaches 1 when it is scattered in
+	// many small Frames.
+	Fragmentation float64
+}
+
+// String returns a one line summary of the statistics, suitable for logs.
+func (s Stats) String() string {
+	return fmt.Sprintf("frames=%d free=%d largest=%d mean=%.1f median=%.1f frag=%.3f",
+		s.Frames, s.Free, s.Largest, s.Mean, s.Median, s.Fragmentation)
+}
+
+// Stats computes the statistics of the free Frames in the tree with a single
+// traversal.
+func (t *CTreeOf[T]) Stats() Stats {
+	var s Stats
+	if t.root == nil {
+		return s
+	}
+
+	lengths := make([]int64, 0, t.Frames)
+	t.root.TraversePre(func(f *FrameOf[T]) error {
+		l := int64(f.Length)
+		lengths = append(lengths, l)
+		s.Free += l
+		if l > 0 {
+			class := bits.Len64(uint64(l)) - 1
+			for len(s.Histogram) <= class {
+				s.Histogram = append(s.Histogram, 0)
+			}
+			s.Histogram[class]++
+		}
+		return nil
+	})
+
+	s.Frames = len(lengths)
+	s.Largest = int64(t.root.Length)
+	s.Mean = float64(s.Free) / float64(s.Frames)
+
+	sort.Slice(lengths, func(i, j int) bool { return lengths[i] < lengths[j] })
+	if mid := len(lengths) / 2; len(lengths)%2 == 1 {
+		s.Median = float64(lengths[mid])
+	} else {
+		s.Median = float64(lengths[mid-1]+lengths[mid]) / 2
+	}
+
+	if s.Free > 0 {
+		s.Fragmentation = 1 - float64(s.Largest)/float64(s.Free)
+	}
+	return s
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package ctree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	s := newValidTree().Stats() // 20, 40, 5, 20, 25, 30, 35
+
+	assert.Equal(t, 7, s.Frames)
+	assert.Equal(t, int64(175), s.Free)
+	assert.Equal(t, int64(40), s.Largest)
+	assert.Equal(t, 25.0, s.Mean)
+	assert.Equal(t, 25.0, s.Median)
+	assert.Equal(t, []int{0, 0, 1, 0, 4, 2}, s.Histogram)
+	assert.InDelta(t, 1-40.0/175, s.Fragmentation, 1e-9)
+	assert.Equal(t, "frames=7 free=175 largest=40 mean=25.0 median=25.0 frag=0.771", s.String())
+}
+
+func TestStatsSingle(t *testing.T) {
+	s := New(100).Stats()
+
+	assert.Equal(t, 1, s.Frames)
+	assert.Equal(t, 100.0, s.Median)
+	assert.Equal(t, 0.0, s.Fragmentation)
+}
+
+func TestStatsEven(t *testing.T) {
+	tree := New(100)
+	tree.Add(NewFrame(200, 50))
+
+	assert.Equal(t, 75.0, tree.Stats().Median)
+}
+
+func TestStatsEmpty(t *testing.T) {
+	s := (&CTree{}).Stats()
+
+	assert.Equal(t, Stats{}, s)
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+// This file contains code for verifying the invariants of the tree
+
+package ctree
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// Debug enables the validation of the whole tree after every change.
+// Any violation causes a panic. It is very slow and meant for debugging only.
+var Debug = false
+
+// Rule identifies one of the properties of a valid tree.
+type Rule int
+
+// Rules checked by Validate.
+const (
+	LengthOrder  Rule = iota // a Frame is longer than its parent
+	AddressOrder             // a Frame is on the wrong side of an ancestor
+	Overlap                  // two Frames overlap
+)
+
+func (r Rule) String() string {
+	switch r {
+	case LengthOrder:
+		return "length order"
+	case AddressOrder:
+		return "address order"
+	case Overlap:
+		return "overlap"
+	}
+	return fmt.Sprintf("Rule(%d)", int(r))
+}
+
+// Violation is a pair of Frames that break a Rule. Frames of all trees are
+// reported with 64 bit addresses.
+// For LengthOrder A is the parent of B, for AddressOrder A is the ancestor
+// of B, for Overlap A comes before B in memory.
+type Violation struct {
+	Rule Rule
+	A, B Frame64
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%v: %v %v", v.Rule, v.A, v.B)
+}
+
+// ValidationError is returned by Validate. It lists all the problems found.
+type ValidationError struct {
+	Violations []Violation
+	Frames     int // value of CTree.Frames
+	Counted    int // Frames actually in the tree
+}
+
+func (e *ValidationError) Error() string {
+	var buf bytes.Buffer
+	buf.WriteString("invalid tree")
+	if e.Frames != e.Counted {
+		fmt.Fprintf(&buf, ", %d frames instead of %d", e.Counted, e.Frames)
+	}
+	for _, v := range e.Violations {
+		fmt.Fprintf(&buf, ", %v", v)
+	}
+	return buf.String()
+}
+
+// bounds is a Frame of the tree together with the closest ancestors that
+// limit its address on the left and on the right.
+type bounds[T Integer] struct {
+	f, lo, hi *FrameOf[T]
+}
+
+// Validate walks the whole tree and checks that all its invariants hold.
+// It returns nil if the tree is valid or a *ValidationError.
+func (t *CTreeOf[T]) Validate() error {
+	var violations []Violation
+	frames := make([]*FrameOf[T], 0, t.Frames)
+
+	if t.root != nil {
+		todo := []bounds[T]{{f: t.root}}
+		for len(todo) > 0 {
+			b := todo[len(todo)-1]
+			todo = todo[:len(todo)-1]
+			f := b.f
+			frames = append(frames, f)
+
+			// nodes in a left subtree can have the same address of the ancestor
+			if b.lo != nil && f.Address <= b.lo.Address {
+				violations = append(violations, Violation{AddressOrder, widen(b.lo), widen(f)})
+			}
+			if b.hi != nil && f.Address > b.hi.Address {
+				violations = append(violations, Violation{AddressOrder, widen(b.hi), widen(f)})
+			}
+			for _, c := range []*FrameOf[T]{f.left, f.right} {
+				if c != nil && c.Length > f.Length {
+					violations = append(violations, Violation{LengthOrder, widen(f), widen(c)})
+				}
+			}
+
+			if f.right != nil {
+				todo = append(todo, bounds[T]{f.right, f, b.hi})
+			}
+			if f.left != nil {
+				todo = append(todo, bounds[T]{f.left, b.lo, f})
+			}
+		}
+	}
+
+	sort.Slice(frames, func(i, j int) bool {
+		return frames[i].Address < frames[j].Address
+	})
+	for i := 1; i < len(frames); i++ {
+		prev, f := frames[i-1], frames[i]
+		if f.Address-prev.Address < prev.Length {
+			violations = append(violations, Violation{Overlap, widen(prev), widen(f)})
+		}
+	}
+
+	if len(violations) == 0 && len(frames) == t.Frames {
+		return nil
+	}
+	return &ValidationError{
+		Violations: violations,
+		Frames:     t.Frames,
+		Counted:    len(frames),
+	}
+}
+
+// debugValidate panics if Debug is enabled and the tree is not valid.
+func (t *CTreeOf[T]) debugValidate() {
+	if Debug {
+		if err := t.Validate(); err != nil {
+			panic(err)
+		}
+	}
+}
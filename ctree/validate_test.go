@@ -0,0 +1,85 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package ctree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newValidTree() *CTree {
+	tree := New(20)
+	tree.Add(NewFrame(130, 40))
+	tree.Add(NewFrame(410, 5))
+	tree.Add(NewFrame(210, 20))
+	tree.Add(NewFrame(180, 25))
+	tree.Add(NewFrame(500, 30))
+	tree.Add(NewFrame(300, 35))
+	return tree
+}
+
+func TestValidateOk(t *testing.T) {
+	assert.NoError(t, newValidTree().Validate())
+	assert.NoError(t, (&CTree{}).Validate())
+}
+
+func TestValidateLengthOrder(t *testing.T) {
+	tree := newValidTree()
+	tree.root.left.Length = 50 // [0,20] is the left child of [130,40]
+
+	err := tree.Validate()
+
+	if assert.IsType(t, &ValidationError{}, err) {
+		assert.Equal(t, []Violation{
+			{LengthOrder, Frame64{Address: 130, Length: 40}, Frame64{Address: 0, Length: 50}},
+		}, err.(*ValidationError).Violations)
+		assert.EqualError(t, err, "invalid tree, length order: [130,40] [0,50]")
+	}
+}
+
+func TestValidateAddressOrder(t *testing.T) {
+	tree := newValidTree()
+	tree.root.right.left.Address = 100 // [180,25] below [300,35]
+
+	err := tree.Validate()
+
+	if assert.IsType(t, &ValidationError{}, err) {
+		assert.Equal(t, []Violation{
+			{AddressOrder, Frame64{Address: 130, Length: 40}, Frame64{Address: 100, Length: 25}},
+		}, err.(*ValidationError).Violations)
+	}
+}
+
+func TestValidateOverlap(t *testing.T) {
+	tree := newValidTree()
+	tree.root.left.Length = 131
+
+	err := tree.Validate()
+
+	if assert.IsType(t, &ValidationError{}, err) {
+		v := err.(*ValidationError).Violations
+		assert.Contains(t, v, Violation{Overlap, Frame64{Address: 0, Length: 131}, Frame64{Address: 130, Length: 40}})
+	}
+}
+
+func TestValidateCount(t *testing.T) {
+	tree := newValidTree()
+	tree.Frames++
+
+	err := tree.Validate()
+
+	assert.EqualError(t, err, "invalid tree, 7 frames instead of 8")
+}
+
+func TestDebug(t *testing.T) {
+	Debug = true
+	defer func() { Debug = false }()
+
+	tree := newValidTree()
+	tree.root.left.Length = 50
+
+	assert.Panics(t, func() { tree.Add(NewFrame(1000, 1)) })
+}
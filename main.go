@@ -1,80 +1,123 @@
 // Copyright (c) 2017 Andrea Cisternino. All rights reserved.
 
+// Command gtm replays a trace of allocation requests, like the ones written
+// by memory.Recorder, and prints the address of each allocated block followed
+// by the statistics of the free memory.
+//
+// Usage:
+//
+//	gtm [-size n] [-seed n] [-tierra] [trace]
+//
+// The trace is read from the standard input when no file is given.
+// With -tierra the input contains the records of a Tierra run, in the format
+// described in memory/tierra.go: the allocations are replayed and compared
+// with the ones performed by Tierra.
 package main
 
 import (
+	"flag"
 	"fmt"
-)
-
-// Frame is a segment of memory
-type Frame struct {
-	addr, length int
-	left, right  int
-}
+	"io"
+	"math"
+	"os"
 
-const (
-	// SIZE is the dimension of the soup
-	SIZE = 50
+	"github.com/acisternino/gtm/ctree"
+	"github.com/acisternino/gtm/memory"
 )
 
 var (
-	frames = make([]Frame, 0, 10)
-	root   int
+	size   = flag.Int("size", 1<<20, "size of the soup when the trace has no header")
+	seed   = flag.Int64("seed", 0, "seed of the random generator of the allocator when the trace has no header")
+	tierra = flag.Bool("tierra", false, "compare with the records of a Tierra run")
 )
 
 func main() {
-	fmt.Println("start")
-
-	fmt.Printf("soup size: %d\n", SIZE)
+	flag.Parse()
+	if *size <= 0 || *size > math.MaxInt32 {
+		fmt.Fprintf(os.Stderr, "invalid soup size %d\n", *size)
+		os.Exit(2)
+	}
 
-	// init data structures
-	frames = append(frames, Frame{0, 0, 0, 0}) // tail frame
-	frames = append(frames, Frame{0, SIZE, 0, 0})
-	root = 1
+	in := os.Stdin
+	if flag.NArg() > 0 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		in = f
+	}
 
-	// try to alloc 10
+	if *tierra {
+		if err := compare(in, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	fmt.Println(frames)
+	a, err := replay(memory.NewTraceReader(in), os.Stdout)
+	if a != nil {
+		fmt.Printf("stats: %v\n", a.Stats())
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
 
-func alloc(size int) {
-	fmt.Printf("allocating %d bytes", size)
-
-	currentFrame := root
-
+// replay performs all the requests read from r on a new Allocator and writes
+// the outcome of each alloc to w. The Allocator is created with the params
+// and the seed in the header of the trace, or with the default params and
+// the command line flags if there is no header. It is returned also in case
+// of errors, as long as it has been created.
+func replay(r *memory.TraceReader, w io.Writer) (*memory.Allocator, error) {
+	var a *memory.Allocator
 	for {
-		frame := frames[currentFrame]
-
-		if frame.length < size {
-			break
+		op, err := r.Read()
+		if err == io.EOF {
+			return a, nil
+		}
+		if err != nil {
+			return a, err
 		}
 
-		left := frames[frame.left]
-		right := frames[frame.right]
-
-		if left.length > size {
-			currentFrame = frame.left
+		if a == nil {
+			p, s := memory.DefaultParams(int32(*size)), *seed
+			if op.Kind == memory.OpSoup {
+				p, s = op.Params, op.Seed
+			}
+			index, err := memory.NewFreeIndex(p.Index, p.SoupSize)
+			if err != nil {
+				return nil, err
+			}
+			a = memory.NewAllocator(index, p, s)
 		}
-		if right.length > size {
-			currentFrame = frame.right
+
+		res, err := a.Replay(op)
+		switch {
+		case op.Kind != memory.OpAlloc && err == nil:
+		case op.Kind != memory.OpAlloc:
+			fmt.Fprintf(w, "%d: %v: %v\n", op.Line, op, err)
+		case err != nil:
+			fmt.Fprintf(w, "%d: %v %v: %v\n", op.Line, op, op.Mode, err)
+		default:
+			fmt.Fprintf(w, "%d: %v %v -> %d\n", op.Line, op, op.Mode, res.Address)
 		}
 	}
-
-	// here currentFrame points to the right one
 }
 
-/*
-	f, err := os.Open(os.Args[1])
+// compare replays the Tierra records read from r on a new Allocator and writes
+// the comparison report to w.
+func compare(r io.Reader, w io.Writer) error {
+	records, err := memory.ReadTierraRecords(r)
 	if err != nil {
-		panic(err)
-	}
-	defer f.Close()
-
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		fmt.Println(scanner.Text())
+		return err
 	}
-	if err := scanner.Err(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-	}
-*/
+	n := int32(*size)
+	a := memory.NewAllocator(memory.NewTreeIndex(ctree.New(n)), memory.DefaultParams(n), *seed)
+	fmt.Fprintln(w, memory.CompareTierra(a, records))
+	fmt.Fprintf(w, "stats: %v\n", a.Stats())
+	return nil
+}
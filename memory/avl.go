@@ -0,0 +1,196 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+// This file contains a balanced binary search tree used by the free indexes
+
+package memory
+
+// avlNode is a node of an avl tree.
+type avlNode[K any] struct {
+	key         K
+	left, right *avlNode[K]
+	height      int
+}
+
+// avl is an AVL tree of keys ordered by less. Keys must be unique.
+type avl[K any] struct {
+	root *avlNode[K]
+	less func(a, b K) bool
+	n    int
+}
+
+func newAVL[K any](less func(a, b K) bool) *avl[K] {
+	return &avl[K]{less: less}
+}
+
+func height[K any](n *avlNode[K]) int {
+	if n == nil {
+		return 0
+	}
+	return n.height
+}
+
+// update recomputes the height of n from the ones of its children.
+func update[K any](n *avlNode[K]) {
+	n.height = 1 + max(height(n.left), height(n.right))
+}
+
+func rotateRight[K any](n *avlNode[K]) *avlNode[K] {
+	l := n.left
+	n.left, l.right = l.right, n
+	update(n)
+	update(l)
+	return l
+}
+
+func rotateLeft[K any](n *avlNode[K]) *avlNode[K] {
+	r := n.right
+	n.right, r.left = r.left, n
+	update(n)
+	update(r)
+	return r
+}
+
+// fix recomputes the height of n and restores the balance of the subtree
+// anchored at n, whose children are balanced. It returns the new root of
+// the subtree.
+func fix[K any](n *avlNode[K]) *avlNode[K] {
+	update(n)
+	switch balance := height(n.left) - height(n.right); {
+	case balance > 1:
+		if height(n.left.left) < height(n.left.right) {
+			n.left = rotateLeft(n.left)
+		}
+		return rotateRight(n)
+	case balance < -1:
+		if height(n.right.right) < height(n.right.left) {
+			n.right = rotateRight(n.right)
+		}
+		return rotateLeft(n)
+	}
+	return n
+}
+
+// insert adds k to the tree.
+func (t *avl[K]) insert(k K) {
+	var ins func(n *avlNode[K]) *avlNode[K]
+	ins = func(n *avlNode[K]) *avlNode[K] {
+		if n == nil {
+			t.n++
+			return &avlNode[K]{key: k, height: 1}
+		}
+		if t.less(k, n.key) {
+			n.left = ins(n.left)
+		} else {
+			n.right = ins(n.right)
+		}
+		return fix(n)
+	}
+	t.root = ins(t.root)
+}
+
+// delete removes k from the tree. It returns false if k is not in the tree.
+func (t *avl[K]) delete(k K) bool {
+	found := false
+	var del func(n *avlNode[K], k K) *avlNode[K]
+	del = func(n *avlNode[K], k K) *avlNode[K] {
+		switch {
+		case n == nil:
+			return nil
+		case t.less(k, n.key):
+			n.left = del(n.left, k)
+		case t.less(n.key, k):
+			n.right = del(n.right, k)
+		default:
+			found = true
+			if n.left == nil {
+				return n.right
+			}
+			if n.right == nil {
+				return n.left
+			}
+			// replace with the smallest key of the right subtree
+			m := n.right
+			for m.left != nil {
+				m = m.left
+			}
+			n.key = m.key
+			n.right = del(n.right, m.key)
+		}
+		return fix(n)
+	}
+	t.root = del(t.root, k)
+	if found {
+		t.n--
+	}
+	return found
+}
+
+// ceil returns the smallest key that is not less than k.
+func (t *avl[K]) ceil(k K) (K, bool) {
+	var best *avlNode[K]
+	for n := t.root; n != nil; {
+		if t.less(n.key, k) {
+			n = n.right
+		} else {
+			best = n
+			n = n.left
+		}
+	}
+	return t.keyOf(best)
+}
+
+// floor returns the largest key that is not greater than k.
+func (t *avl[K]) floor(k K) (K, bool) {
+	var best *avlNode[K]
+	for n := t.root; n != nil; {
+		if t.less(k, n.key) {
+			n = n.left
+		} else {
+			best = n
+			n = n.right
+		}
+	}
+	return t.keyOf(best)
+}
+
+// higher returns the smallest key that is greater than k.
+func (t *avl[K]) higher(k K) (K, bool) {
+	var best *avlNode[K]
+	for n := t.root; n != nil; {
+		if t.less(k, n.key) {
+			best = n
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	return t.keyOf(best)
+}
+
+func (t *avl[K]) keyOf(n *avlNode[K]) (K, bool) {
+	if n == nil {
+		var zero K
+		return zero, false
+	}
+	return n.key, true
+}
+
+// walk calls visit for all the keys in order, until visit returns false.
+func (t *avl[K]) walk(visit func(K) bool) {
+	var todo []*avlNode[K]
+	n := t.root
+	for n != nil || len(todo) > 0 {
+		for n != nil {
+			todo = append(todo, n)
+			n = n.left
+		}
+		n = todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+		if !visit(n.key) {
+			return
+		}
+		n = n.right
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// balanced checks the heights of the subtree anchored at n and returns its
+// height.
+func balanced(t *testing.T, n *avlNode[int]) int {
+	if n == nil {
+		return 0
+	}
+	l, r := balanced(t, n.left), balanced(t, n.right)
+	assert.True(t, l-r <= 1 && r-l <= 1, "unbalanced node %d", n.key)
+	assert.Equal(t, 1+max(l, r), n.height, "height of node %d", n.key)
+	return n.height
+}
+
+func TestAVL(t *testing.T) {
+	tree := newAVL(func(a, b int) bool { return a < b })
+	r := rand.New(rand.NewSource(1))
+	keys := r.Perm(1000)
+	for _, k := range keys {
+		tree.insert(k * 2)
+	}
+	for _, k := range keys[:500] {
+		assert.True(t, tree.delete(k*2))
+	}
+	assert.False(t, tree.delete(1))
+	balanced(t, tree.root)
+
+	left := append([]int(nil), keys[500:]...)
+	sort.Ints(left)
+	var walked []int
+	tree.walk(func(k int) bool {
+		walked = append(walked, k/2)
+		return true
+	})
+	assert.Equal(t, left, walked)
+	assert.Equal(t, 500, tree.n)
+
+	k, ok := tree.ceil(2*left[0] + 1)
+	assert.True(t, ok)
+	assert.Equal(t, 2*left[1], k)
+	k, ok = tree.floor(2*left[1] - 1)
+	assert.True(t, ok)
+	assert.Equal(t, 2*left[0], k)
+	k, ok = tree.higher(2 * left[0])
+	assert.True(t, ok)
+	assert.Equal(t, 2*left[1], k)
+	_, ok = tree.higher(2 * left[499])
+	assert.False(t, ok)
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+// This file contains a FreeIndex made of balanced binary search trees
+
+package memory
+
+import (
+	"math"
+
+	"github.com/acisternino/gtm/ctree"
+)
+
+// BSTIndex keeps the free Frames in two balanced trees, one sorted by
+// length and one by address. All its operations take logarithmic time, but
+// every Frame is stored twice.
+type BSTIndex struct {
+	addressIndex
+	bySize *avl[ctree.Frame]
+}
+
+// NewBSTIndex returns an empty BSTIndex.
+func NewBSTIndex() *BSTIndex {
+	return &BSTIndex{
+		addressIndex: newAddressIndex(),
+		bySize:       newAVL(byLength),
+	}
+}
+
+// Insert implements FreeIndex.
+func (x *BSTIndex) Insert(f ctree.Frame) {
+	x.frames.insert(f)
+	x.bySize.insert(f)
+}
+
+// Delete implements FreeIndex.
+func (x *BSTIndex) Delete(f ctree.Frame) error {
+	if g, ok := x.find(f.Address); !ok || g != f {
+		return ctree.ErrFrameNotFound
+	}
+	x.frames.delete(f)
+	x.bySize.delete(f)
+	return nil
+}
+
+// Smallest implements FreeIndex.
+func (x *BSTIndex) Smallest(size int32) (ctree.Frame, bool) {
+	return x.bySize.ceil(ctree.Frame{Address: math.MinInt32, Length: size})
+}
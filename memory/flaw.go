@@ -0,0 +1,49 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+// This file contains the model of allocation flaws
+
+package memory
+
+import "math/rand"
+
+// Flaws configures the random perturbation of allocation sizes that Tierra
+// uses as a mutation mechanism.
+// A flawed allocation has its size changed by a random amount between
+// -Magnitude and +Magnitude, zero excluded. The sequence of flaws only
+// depends on Seed, so runs with the same seed can be replayed exactly.
+type Flaws struct {
+	Rate      float64 // probability of a flaw, between 0 and 1
+	Magnitude int32   // maximum size change
+	Seed      int64   // seed of the flaw generator
+}
+
+// flawSource generates the flaws described by a Flaws configuration.
+type flawSource struct {
+	Flaws
+	rand *rand.Rand
+}
+
+func newFlawSource(f Flaws) *flawSource {
+	return &flawSource{
+		Flaws: f,
+		rand:  rand.New(rand.NewSource(f.Seed)),
+	}
+}
+
+// perturb returns size, possibly changed by a flaw. The result is never
+// smaller than 1.
+func (fs *flawSource) perturb(size int32) int32 {
+	if fs.Rate <= 0 || fs.Magnitude <= 0 || fs.rand.Float64() >= fs.Rate {
+		return size
+	}
+	delta := fs.rand.Int31n(fs.Magnitude) + 1
+	if fs.rand.Intn(2) == 0 {
+		delta = -delta
+	}
+	if size += delta; size < 1 {
+		size = 1
+	}
+	return size
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPerturbNoFlaws(t *testing.T) {
+	fs := newFlawSource(Flaws{})
+
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, int32(80), fs.perturb(80))
+	}
+}
+
+func TestPerturbAlways(t *testing.T) {
+	fs := newFlawSource(Flaws{Rate: 1, Magnitude: 2, Seed: 7})
+
+	for i := 0; i < 100; i++ {
+		size := fs.perturb(80)
+		assert.NotEqual(t, int32(80), size)
+		assert.InDelta(t, 80, size, 2)
+	}
+}
+
+func TestPerturbMinimum(t *testing.T) {
+	fs := newFlawSource(Flaws{Rate: 1, Magnitude: 10, Seed: 7})
+
+	for i := 0; i < 100; i++ {
+		assert.True(t, fs.perturb(1) >= 1)
+	}
+}
+
+func TestPerturbReplay(t *testing.T) {
+	f := Flaws{Rate: 0.3, Magnitude: 3, Seed: 42}
+	a, b := newFlawSource(f), newFlawSource(f)
+
+	flawed := 0
+	for i := 0; i < 1000; i++ {
+		size := a.perturb(80)
+		assert.Equal(t, size, b.perturb(80))
+		if size != 80 {
+			flawed++
+		}
+	}
+	assert.InDelta(t, 300, flawed, 60)
+}
+
+func TestMalFlawed(t *testing.T) {
+	p := testParams
+	p.Flaws = Flaws{Rate: 1, Magnitude: 1, Seed: 3}
+	a := NewAllocator(newTestAllocator().Index, p, 1)
+
+	res, err := a.Mal(mother, 0, 40, BetterFit)
+
+	if assert.NoError(t, err) {
+		assert.InDelta(t, 40, res.Size, 1)
+		assert.NotEqual(t, int32(40), res.Size)
+	}
+}
@@ -0,0 +1,347 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+// This file contains the interface to the data structures that keep track
+// of the free memory
+
+package memory
+
+import (
+	"fmt"
+
+	"github.com/acisternino/gtm/ctree"
+	"github.com/pkg/errors"
+)
+
+// FreeIndex is a collection of free Frames that do not overlap. It is the
+// data structure used by MemAlloc and MemDealloc.
+// Frames are passed by value and always have a positive length.
+type FreeIndex interface {
+	// Insert adds f to the index. f must not overlap the Frames in the
+	// index, it is not merged with the ones it touches.
+	Insert(f ctree.Frame)
+
+	// Delete takes f out of the index. It returns ctree.ErrFrameNotFound if
+	// there is no Frame with the same address and length.
+	Delete(f ctree.Frame) error
+
+	// Smallest returns the smallest Frame whose length is equal or larger
+	// than size. When several Frames have the same length, the one with the
+	// lowest address is returned. The boolean is false if no Frame is large
+	// enough.
+	Smallest(size int32) (ctree.Frame, bool)
+
+	// Neighbours returns the last Frame starting at or before address and
+	// the first one starting after it. Missing Frames have zero length.
+	Neighbours(address int32) (prev, next ctree.Frame)
+
+	// Len returns the number of Frames in the index.
+	Len() int
+
+	// Walk calls visit for all the Frames by increasing address. An error
+	// returned by visit stops the iteration and is returned, unless it is
+	// ctree.ErrStop.
+	Walk(visit func(ctree.Frame) error) error
+}
+
+// friendlyFitter is implemented by the indexes that can perform a Friendly
+// fit search faster than friendlyFit.
+type friendlyFitter interface {
+	FriendlyFit(size, pref, tol int32) (ctree.Frame, int32, bool)
+}
+
+// coalescer is implemented by the indexes that can add a Frame merging it
+// with its neighbours on their own.
+type coalescer interface {
+	Coalesce(f ctree.Frame) error
+}
+
+// IndexKind selects the FreeIndex of a Soup.
+type IndexKind int
+
+// Kinds of indexes.
+const (
+	CartesianTree   IndexKind = iota // TreeIndex, like Tierra
+	SegregatedLists                  // SegregatedIndex
+	BalancedTrees                    // BSTIndex
+)
+
+var indexNames = [...]string{
+	CartesianTree:   "ctree",
+	SegregatedLists: "segregated",
+	BalancedTrees:   "bst",
+}
+
+func (k IndexKind) String() string {
+	if k >= 0 && int(k) < len(indexNames) {
+		return indexNames[k]
+	}
+	return fmt.Sprintf("IndexKind(%d)", int(k))
+}
+
+// ErrInvalidIndex is returned by NewFreeIndex for unknown kinds.
+var ErrInvalidIndex = errors.New("invalid index kind")
+
+// NewFreeIndex returns an index of the given kind holding a single Frame of
+// the given length at address 0. The length must be positive.
+func NewFreeIndex(kind IndexKind, length int32) (FreeIndex, error) {
+	if length <= 0 {
+		return nil, errors.Wrapf(ErrInvalidSize, "length %d is not positive", length)
+	}
+	var index FreeIndex
+	switch kind {
+	case CartesianTree:
+		return NewTreeIndex(ctree.New(length)), nil
+	case SegregatedLists:
+		index = NewSegregatedIndex()
+	case BalancedTrees:
+		index = NewBSTIndex()
+	default:
+		return nil, errors.Wrapf(ErrInvalidIndex, "kind %d", kind)
+	}
+	index.Insert(ctree.Frame{Address: 0, Length: length})
+	return index, nil
+}
+
+// frameOf returns a copy of f without its links to other Frames.
+func frameOf(f *ctree.Frame) ctree.Frame {
+	return ctree.Frame{Address: f.Address, Length: f.Length}
+}
+
+// TreeIndex is the FreeIndex of the original Tierra: a cartesian tree.
+// All the methods of the tree are available.
+type TreeIndex struct {
+	*ctree.CTree
+}
+
+// NewTreeIndex returns a TreeIndex working on tree.
+func NewTreeIndex(tree *ctree.CTree) *TreeIndex {
+	return &TreeIndex{tree}
+}
+
+// Insert implements FreeIndex.
+func (t *TreeIndex) Insert(f ctree.Frame) {
+	t.Add(&f)
+}
+
+// Delete implements FreeIndex.
+func (t *TreeIndex) Delete(f ctree.Frame) error {
+	prev, _ := t.CTree.Neighbours(f.Address)
+	if prev == nil || prev.Address != f.Address || prev.Length != f.Length {
+		return ctree.ErrFrameNotFound
+	}
+	return t.Remove(prev)
+}
+
+// Smallest implements FreeIndex.
+func (t *TreeIndex) Smallest(size int32) (ctree.Frame, bool) {
+	f := t.BetterFit(size)
+	if f == nil {
+		return ctree.Frame{}, false
+	}
+	return frameOf(f), true
+}
+
+// Neighbours implements FreeIndex.
+func (t *TreeIndex) Neighbours(address int32) (prev, next ctree.Frame) {
+	p, n := t.CTree.Neighbours(address)
+	if p != nil {
+		prev = frameOf(p)
+	}
+	if n != nil {
+		next = frameOf(n)
+	}
+	return
+}
+
+// Len implements FreeIndex.
+func (t *TreeIndex) Len() int {
+	return t.Frames
+}
+
+// Walk implements FreeIndex.
+func (t *TreeIndex) Walk(visit func(ctree.Frame) error) error {
+	c := t.Cursor()
+	for c.Next() {
+		if err := visit(frameOf(c.Frame())); err != nil {
+			return stopped(err)
+		}
+	}
+	return nil
+}
+
+// FriendlyFit uses the pruned search of the tree.
+func (t *TreeIndex) FriendlyFit(size, pref, tol int32) (ctree.Frame, int32, bool) {
+	f, address := t.CTree.FriendlyFit(size, pref, tol)
+	if f == nil {
+		return ctree.Frame{}, 0, false
+	}
+	return frameOf(f), address, true
+}
+
+// Coalesce uses the merging insertion of the tree.
+func (t *TreeIndex) Coalesce(f ctree.Frame) error {
+	_, err := t.CTree.Coalesce(&f)
+	return err
+}
+
+// stopped filters out ctree.ErrStop.
+func stopped(err error) error {
+	if err == ctree.ErrStop {
+		return nil
+	}
+	return err
+}
+
+// friendlyFit searches the Frame where a block of the given size can be
+// placed nearest to pref, at most tol slots away. It works like
+// ctree.CTree.FriendlyFit on any index, visiting the Frames around pref.
+func friendlyFit(index FreeIndex, size, pref, tol int32) (ctree.Frame, int32, bool) {
+	var best ctree.Frame
+	var bestAddr, bestDist int64
+	found := false
+	consider := func(f ctree.Frame) {
+		if f.Length < size {
+			return
+		}
+		addr := min(int64(pref), int64(f.Address)+int64(f.Length-size))
+		addr = max(addr, int64(f.Address))
+		dist := addr - int64(pref)
+		if dist < 0 {
+			dist = -dist
+		}
+		if dist <= int64(tol) && (!found || dist < bestDist || (dist == bestDist && addr < bestAddr)) {
+			best, bestAddr, bestDist, found = f, addr, dist, true
+		}
+	}
+
+	// going left, the best placements get farther from pref: stop at the
+	// first Frame that fits or when the Frames end too early
+	prev, next := index.Neighbours(pref)
+	for prev.Length > 0 {
+		if int64(prev.Address)+int64(prev.Length)-int64(size) < int64(pref)-int64(tol) {
+			break
+		}
+		if consider(prev); found {
+			break
+		}
+		if prev.Address == 0 {
+			break
+		}
+		prev, _ = index.Neighbours(prev.Address - 1)
+	}
+
+	// going right, the Frames start farther from pref
+	for next.Length > 0 {
+		dist := int64(next.Address) - int64(pref)
+		if dist > int64(tol) || (found && dist >= bestDist) {
+			break
+		}
+		consider(next)
+		_, next = index.Neighbours(next.Address)
+	}
+	return best, int32(bestAddr), found
+}
+
+// coalesce adds f to the index merging it with the free Frames it touches
+// on either side. If f overlaps a free Frame the index is not modified and
+// a *ctree.OverlapError is returned.
+func coalesce(index FreeIndex, f ctree.Frame) error {
+	if c, ok := index.(coalescer); ok {
+		return c.Coalesce(f)
+	}
+
+	prev, next := index.Neighbours(f.Address)
+	joinPrev, joinNext, err := f.Joins(present(prev), present(next))
+	if err != nil {
+		return err
+	}
+	if joinPrev {
+		index.Delete(prev)
+		f.Address = prev.Address
+		f.Length += prev.Length
+	}
+	if joinNext {
+		index.Delete(next)
+		f.Length += next.Length
+	}
+	index.Insert(f)
+	return nil
+}
+
+// present returns a pointer to f, or nil if f is a missing Frame returned by
+// FreeIndex.Neighbours.
+func present(f ctree.Frame) *ctree.Frame {
+	if f.Length == 0 {
+		return nil
+	}
+	return &f
+}
+
+// indexStats returns the statistics of the free Frames in index.
+func indexStats(index FreeIndex) ctree.Stats {
+	if t, ok := index.(*TreeIndex); ok {
+		return t.Stats()
+	}
+	frames := make([]*ctree.Frame, 0, index.Len())
+	index.Walk(func(f ctree.Frame) error {
+		frames = append(frames, &f)
+		return nil
+	})
+	tree, err := ctree.Build(frames)
+	if err != nil {
+		// an index never contains overlapping Frames
+		panic(err)
+	}
+	return tree.Stats()
+}
+
+// byAddress orders Frames by address.
+func byAddress(a, b ctree.Frame) bool {
+	return a.Address < b.Address
+}
+
+// byLength orders Frames by length, then by address.
+func byLength(a, b ctree.Frame) bool {
+	return a.Length < b.Length || (a.Length == b.Length && a.Address < b.Address)
+}
+
+// addressIndex is the part of a FreeIndex that keeps the Frames in address
+// order.
+type addressIndex struct {
+	frames *avl[ctree.Frame]
+}
+
+func newAddressIndex() addressIndex {
+	return addressIndex{newAVL(byAddress)}
+}
+
+// find returns the Frame starting at address.
+func (x addressIndex) find(address int32) (ctree.Frame, bool) {
+	f, ok := x.frames.floor(ctree.Frame{Address: address})
+	return f, ok && f.Address == address
+}
+
+// Neighbours implements FreeIndex.
+func (x addressIndex) Neighbours(address int32) (prev, next ctree.Frame) {
+	key := ctree.Frame{Address: address}
+	prev, _ = x.frames.floor(key)
+	next, _ = x.frames.higher(key)
+	return
+}
+
+// Len implements FreeIndex.
+func (x addressIndex) Len() int {
+	return x.frames.n
+}
+
+// Walk implements FreeIndex.
+func (x addressIndex) Walk(visit func(ctree.Frame) error) error {
+	var err error
+	x.frames.walk(func(f ctree.Frame) bool {
+		err = visit(f)
+		return err == nil
+	})
+	return stopped(err)
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/acisternino/gtm/ctree"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+var indexKinds = []IndexKind{CartesianTree, SegregatedLists, BalancedTrees}
+
+// indexFrames returns the Frames of index by increasing address.
+func indexFrames(index FreeIndex) []ctree.Frame {
+	var frames []ctree.Frame
+	index.Walk(func(f ctree.Frame) error {
+		frames = append(frames, f)
+		return nil
+	})
+	return frames
+}
+
+// newIndex returns an index of the given kind with Frames [0,100], [300,50]
+// and [600,400].
+func newIndex(kind IndexKind) FreeIndex {
+	index, _ := NewFreeIndex(kind, 100)
+	index.Insert(ctree.Frame{Address: 300, Length: 50})
+	index.Insert(ctree.Frame{Address: 600, Length: 400})
+	return index
+}
+
+func TestIndexNeighbours(t *testing.T) {
+	for _, kind := range indexKinds {
+		index := newIndex(kind)
+
+		prev, next := index.Neighbours(300)
+		assert.Equal(t, ctree.Frame{Address: 300, Length: 50}, prev, "%v", kind)
+		assert.Equal(t, ctree.Frame{Address: 600, Length: 400}, next, "%v", kind)
+
+		prev, next = index.Neighbours(700)
+		assert.Equal(t, ctree.Frame{Address: 600, Length: 400}, prev, "%v", kind)
+		assert.Equal(t, int32(0), next.Length, "%v", kind)
+	}
+}
+
+func TestIndexSmallest(t *testing.T) {
+	for _, kind := range indexKinds {
+		index := newIndex(kind)
+		index.Insert(ctree.Frame{Address: 200, Length: 50})
+
+		f, ok := index.Smallest(40)
+		assert.True(t, ok, "%v", kind)
+		assert.Equal(t, ctree.Frame{Address: 200, Length: 50}, f, "%v", kind)
+
+		f, ok = index.Smallest(60)
+		assert.True(t, ok, "%v", kind)
+		assert.Equal(t, ctree.Frame{Address: 0, Length: 100}, f, "%v", kind)
+
+		_, ok = index.Smallest(401)
+		assert.False(t, ok, "%v", kind)
+	}
+}
+
+func TestIndexDelete(t *testing.T) {
+	for _, kind := range indexKinds {
+		index := newIndex(kind)
+
+		assert.Equal(t, ctree.ErrFrameNotFound, index.Delete(ctree.Frame{Address: 300, Length: 40}), "%v", kind)
+		assert.Equal(t, ctree.ErrFrameNotFound, index.Delete(ctree.Frame{Address: 310, Length: 50}), "%v", kind)
+		assert.NoError(t, index.Delete(ctree.Frame{Address: 300, Length: 50}), "%v", kind)
+		assert.Equal(t, 2, index.Len(), "%v", kind)
+		assert.Equal(t, []ctree.Frame{{Address: 0, Length: 100}, {Address: 600, Length: 400}},
+			indexFrames(index), "%v", kind)
+	}
+}
+
+func TestIndexDoubleFree(t *testing.T) {
+	for _, kind := range indexKinds {
+		index := newIndex(kind)
+
+		err := MemDealloc(index, 320, 10)
+
+		if assert.Error(t, err, "%v", kind) {
+			assert.IsType(t, &ctree.OverlapError{}, errors.Cause(err), "%v", kind)
+		}
+		assert.Equal(t, 3, index.Len(), "%v", kind)
+
+		assert.NoError(t, MemDealloc(index, 350, 250), "%v", kind)
+		assert.Equal(t, []ctree.Frame{{Address: 0, Length: 100}, {Address: 300, Length: 700}},
+			indexFrames(index), "%v", kind)
+	}
+}
+
+func TestIndexWalkStop(t *testing.T) {
+	for _, kind := range indexKinds {
+		n := 0
+		err := newIndex(kind).Walk(func(ctree.Frame) error {
+			n++
+			return ctree.ErrStop
+		})
+		assert.NoError(t, err, "%v", kind)
+		assert.Equal(t, 1, n, "%v", kind)
+	}
+}
+
+func TestNewFreeIndexInvalid(t *testing.T) {
+	_, err := NewFreeIndex(IndexKind(7), 100)
+
+	assert.Equal(t, ErrInvalidIndex, errors.Cause(err))
+	assert.Equal(t, "IndexKind(7)", IndexKind(7).String())
+
+	for _, kind := range indexKinds {
+		for _, length := range []int32{0, -10} {
+			_, err := NewFreeIndex(kind, length)
+			assert.Equal(t, ErrInvalidSize, errors.Cause(err), "%v %d", kind, length)
+		}
+	}
+}
+
+func TestSoupInvalidParams(t *testing.T) {
+	_, err := NewSoup(0)
+	assert.Equal(t, ErrInvalidParams, errors.Cause(err))
+
+	p := DefaultParams(1000)
+	p.Index = IndexKind(7)
+	_, err = NewSoupWithParams(p, 0)
+	assert.Equal(t, ErrInvalidIndex, errors.Cause(err))
+}
+
+func TestSoupIndex(t *testing.T) {
+	p := DefaultParams(1000)
+	p.Index = BalancedTrees
+	s, _ := NewSoupWithParams(p, 0)
+
+	assert.IsType(t, &BSTIndex{}, s.alloc.Index)
+	res, err := s.Mal(1, mother, 0, 80, BetterFit)
+	if assert.NoError(t, err) {
+		assert.Equal(t, Segment{Address: 0, Size: 80}, res.Segment)
+		assert.Equal(t, int64(920), s.Stats().Free)
+	}
+}
+
+// TestIndexesSameAsCTree performs the same random allocations on all the
+// kinds of index and compares the results.
+func TestIndexesSameAsCTree(t *testing.T) {
+	const size = 10000
+	r := rand.New(rand.NewSource(1))
+	indexes := make([]FreeIndex, len(indexKinds))
+	for i, kind := range indexKinds {
+		indexes[i], _ = NewFreeIndex(kind, size)
+	}
+	var blocks []Segment
+
+	for i := 0; i < 5000; i++ {
+		if r.Intn(2) == 0 && len(blocks) > 0 {
+			j := r.Intn(len(blocks))
+			b := blocks[j]
+			blocks[j] = blocks[len(blocks)-1]
+			blocks = blocks[:len(blocks)-1]
+			for k, index := range indexes {
+				assert.NoError(t, MemDealloc(index, b.Address, b.Size), "%v", indexKinds[k])
+			}
+			continue
+		}
+
+		length := int32(r.Intn(100) + 1)
+		pref, tol := int32(-1), int32(0)
+		if r.Intn(2) == 0 {
+			pref, tol = int32(r.Intn(size)), int32(r.Intn(500))
+		}
+		want, werr := MemAlloc(indexes[0], length, pref, tol)
+		for k, index := range indexes[1:] {
+			got, err := MemAlloc(index, length, pref, tol)
+			assert.Equal(t, werr, err, "%v", indexKinds[k+1])
+			assert.Equal(t, want, got, "%v", indexKinds[k+1])
+		}
+		if werr == nil {
+			blocks = append(blocks, Segment{Address: want, Size: length})
+		}
+	}
+
+	assert.NoError(t, indexes[0].(*TreeIndex).Validate())
+	for k, index := range indexes[1:] {
+		assert.Equal(t, indexes[0].Len(), index.Len(), "%v", indexKinds[k+1])
+		assert.Equal(t, indexFrames(indexes[0]), indexFrames(index), "%v", indexKinds[k+1])
+	}
+}
+
+// TestFriendlyFitSameAsCTree checks the generic Friendly fit against the
+// search of the cartesian tree.
+func TestFriendlyFitSameAsCTree(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	tree := NewTreeIndex(ctree.New(10))
+	for a := int32(20); a < 5000; a += 10 + r.Int31n(90) {
+		l := r.Int31n(60) + 1
+		tree.Insert(ctree.Frame{Address: a, Length: l})
+		a += l
+	}
+
+	for i := 0; i < 2000; i++ {
+		size, pref, tol := r.Int31n(60)+1, r.Int31n(5000), r.Int31n(300)
+		f, addr, ok := friendlyFit(tree, size, pref, tol)
+		wf, waddr, wok := tree.FriendlyFit(size, pref, tol)
+		if assert.Equal(t, wok, ok) && ok {
+			assert.Equal(t, wf, f)
+			assert.Equal(t, waddr, addr)
+		}
+	}
+}
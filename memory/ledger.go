@@ -0,0 +1,118 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+// This file contains the ledger of allocated memory
+
+package memory
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Block is a Segment of allocated memory together with its owner.
+type Block struct {
+	Segment
+	Owner int   // ID of the owner cell
+	Time  int64 // time of allocation
+}
+
+// contains tests if address is inside the Block.
+func (b *Block) contains(address int32) bool {
+	return address >= b.Address && address-b.Address < b.Size
+}
+
+// Ledger keeps track of the allocated Blocks and of the cells owning them.
+// While the free memory is kept in a FreeIndex, the Ledger is the only record
+// of the allocated one.
+type Ledger struct {
+	blocks []Block         // sorted by address
+	owners map[int][]int32 // addresses of the Blocks of each owner
+}
+
+// NewLedger returns an empty Ledger.
+func NewLedger() *Ledger {
+	return &Ledger{owners: make(map[int][]int32)}
+}
+
+// Len returns the number of Blocks in the Ledger.
+func (l *Ledger) Len() int {
+	return len(l.blocks)
+}
+
+// search returns the index of the first Block that ends after address.
+func (l *Ledger) search(address int32) int {
+	return sort.Search(len(l.blocks), func(i int) bool {
+		b := &l.blocks[i]
+		return b.Address+b.Size > address
+	})
+}
+
+// Add records a new Block. Blocks can not overlap.
+func (l *Ledger) Add(b Block) error {
+	i := l.search(b.Address)
+	if i < len(l.blocks) && l.blocks[i].Address < b.Address+b.Size {
+		o := &l.blocks[i]
+		return errors.Errorf("block [%d,%d] overlaps block [%d,%d] of cell %d",
+			b.Address, b.Size, o.Address, o.Size, o.Owner)
+	}
+	l.blocks = append(l.blocks, Block{})
+	copy(l.blocks[i+1:], l.blocks[i:])
+	l.blocks[i] = b
+	l.owners[b.Owner] = append(l.owners[b.Owner], b.Address)
+	return nil
+}
+
+// Remove deletes the Block starting at address and returns it.
+func (l *Ledger) Remove(address int32) (Block, bool) {
+	i := l.search(address)
+	if i == len(l.blocks) || l.blocks[i].Address != address {
+		return Block{}, false
+	}
+	b := l.blocks[i]
+	l.blocks = append(l.blocks[:i], l.blocks[i+1:]...)
+
+	addrs := l.owners[b.Owner]
+	for j, a := range addrs {
+		if a == address {
+			addrs = append(addrs[:j], addrs[j+1:]...)
+			break
+		}
+	}
+	if len(addrs) == 0 {
+		delete(l.owners, b.Owner)
+	} else {
+		l.owners[b.Owner] = addrs
+	}
+	return b, true
+}
+
+// RemoveOwner deletes all the Blocks of a cell and returns them.
+func (l *Ledger) RemoveOwner(owner int) []Block {
+	blocks := l.Blocks(owner)
+	for _, b := range blocks {
+		l.Remove(b.Address)
+	}
+	return blocks
+}
+
+// Owner returns the Block containing address.
+func (l *Ledger) Owner(address int32) (Block, bool) {
+	i := l.search(address)
+	if i == len(l.blocks) || !l.blocks[i].contains(address) {
+		return Block{}, false
+	}
+	return l.blocks[i], true
+}
+
+// Blocks returns the Blocks owned by a cell, in allocation order.
+func (l *Ledger) Blocks(owner int) []Block {
+	addrs := l.owners[owner]
+	blocks := make([]Block, 0, len(addrs))
+	for _, a := range addrs {
+		blocks = append(blocks, l.blocks[l.search(a)])
+	}
+	return blocks
+}
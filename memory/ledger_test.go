@@ -0,0 +1,78 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newBlock(address, size int32, owner int) Block {
+	return Block{Segment: Segment{Address: address, Size: size}, Owner: owner}
+}
+
+func newTestLedger() *Ledger {
+	l := NewLedger()
+	l.Add(newBlock(100, 50, 1))
+	l.Add(newBlock(0, 50, 2))
+	l.Add(newBlock(300, 20, 1))
+	return l
+}
+
+func TestLedgerOwner(t *testing.T) {
+	l := newTestLedger()
+
+	for addr, owner := range map[int32]int{0: 2, 49: 2, 100: 1, 149: 1, 310: 1} {
+		b, ok := l.Owner(addr)
+		if assert.True(t, ok, "address %d", addr) {
+			assert.Equal(t, owner, b.Owner, "address %d", addr)
+		}
+	}
+	for _, addr := range []int32{-1, 50, 99, 150, 320} {
+		_, ok := l.Owner(addr)
+		assert.False(t, ok, "address %d", addr)
+	}
+}
+
+func TestLedgerOverlap(t *testing.T) {
+	l := newTestLedger()
+
+	err := l.Add(newBlock(140, 20, 3))
+
+	assert.EqualError(t, err, "block [140,20] overlaps block [100,50] of cell 1")
+	assert.Equal(t, 3, l.Len())
+}
+
+func TestLedgerBlocks(t *testing.T) {
+	l := newTestLedger()
+
+	assert.Equal(t, []Block{newBlock(100, 50, 1), newBlock(300, 20, 1)}, l.Blocks(1))
+	assert.Empty(t, l.Blocks(3))
+}
+
+func TestLedgerRemove(t *testing.T) {
+	l := newTestLedger()
+
+	b, ok := l.Remove(100)
+	if assert.True(t, ok) {
+		assert.Equal(t, newBlock(100, 50, 1), b)
+		assert.Equal(t, 2, l.Len())
+		assert.Len(t, l.Blocks(1), 1)
+	}
+
+	_, ok = l.Remove(110)
+	assert.False(t, ok)
+}
+
+func TestLedgerRemoveOwner(t *testing.T) {
+	l := newTestLedger()
+
+	blocks := l.RemoveOwner(1)
+
+	assert.Len(t, blocks, 2)
+	assert.Equal(t, 1, l.Len())
+	assert.Empty(t, l.Blocks(1))
+}
@@ -0,0 +1,241 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+// This file contains the port of the mal function in memalloc.c and of the
+// size checks performed by malchm in instruct.c
+
+package memory
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/acisternino/gtm/ctree"
+	"github.com/pkg/errors"
+)
+
+// Mode is the allocation mode of a mal instruction.
+type Mode int
+
+// Allocation modes. The numbering is the same used by Tierra.
+const (
+	FirstFit     Mode = iota // lowest free address
+	BetterFit                // smallest free Frame that fits
+	RandomPref               // near a random address
+	NearMother               // near the mother cell
+	NearAddress              // near the address in the dx register
+	NearStack                // near the address at the top of the stack
+	SuggestedFit             // exactly at the suggested address
+)
+
+var modeNames = [...]string{
+	FirstFit:     "firstfit",
+	BetterFit:    "betterfit",
+	RandomPref:   "randompref",
+	NearMother:   "nearmother",
+	NearAddress:  "nearaddress",
+	NearStack:    "nearstack",
+	SuggestedFit: "suggestedfit",
+}
+
+func (m Mode) String() string {
+	if m >= 0 && int(m) < len(modeNames) {
+		return modeNames[m]
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// ErrInvalidSize is the cause of errors returned by Mal for requests that
+// fail the size checks.
+var ErrInvalidSize = errors.New("invalid size")
+
+// ErrInvalidMode is returned by Mal for unknown allocation modes.
+var ErrInvalidMode = errors.New("invalid allocation mode")
+
+// ErrInvalidParams is returned by Mal when the Params of the Allocator do not
+// describe a usable soup.
+var ErrInvalidParams = errors.New("invalid soup parameters")
+
+// Params contains the soup parameters that drive allocation.
+type Params struct {
+	SoupSize    int32     // size of the soup
+	MinCellSize int32     // minimum size of a cell
+	MaxMalMult  int32     // maximum ratio between daughter and mother size
+	MalTol      int32     // tolerance of friendly fit, in multiples of AvgSize
+	AvgSize     int32     // average size of the cells in the soup
+	Flaws       Flaws     // perturbation of the allocated sizes
+	Index       IndexKind // data structure of the free Frames of a Soup
+}
+
+// Segment is a block of allocated memory.
+type Segment struct {
+	Address int32
+	Size    int32
+}
+
+// Allocation is the outcome of a Mal request.
+type Allocation struct {
+	Segment
+	Reaped int   // number of cells reaped to make room
+	Freed  int32 // number of slots freed by reaping
+}
+
+// Allocator performs mal requests on an index of free Frames.
+// If Reaper is not nil, it is used to free memory when the soup is full.
+// If Recorder is not nil, all the requests are written to it as a trace.
+type Allocator struct {
+	Index    FreeIndex
+	Params   Params
+	Reaper   Reaper
+	Recorder *Recorder
+	seed     int64
+	rand     *rand.Rand
+	flaws    *flawSource
+}
+
+// NewAllocator returns an Allocator for index. The seed initializes the
+// random generator used by the RandomPref mode, flaws have their own seed in
+// the Params.
+func NewAllocator(index FreeIndex, p Params, seed int64) *Allocator {
+	return &Allocator{
+		Index:  index,
+		Params: p,
+		seed:   seed,
+		rand:   rand.New(rand.NewSource(seed)),
+		flaws:  newFlawSource(p.Flaws),
+	}
+}
+
+// Mal allocates a block of sugSize slots for the daughter of the cell
+// occupying the mother Segment. It returns the allocated Segment, whose size
+// can differ from the requested one because of flaws.
+//
+// sugAddr is the address suggested by the cell. It is only used by the
+// NearAddress, NearStack and SuggestedFit modes; the caller is expected to
+// fill it with the value of the relevant register.
+//
+// When there is no room for the block, cells are reaped one at a time and
+// their memory is freed until the allocation succeeds or the Reaper has no
+// more victims. The number of reaped cells is reported in the Allocation,
+// also when the allocation fails.
+func (a *Allocator) Mal(mother Segment, sugAddr, sugSize int32, mode Mode) (Allocation, error) {
+	if a.Recorder != nil {
+		// recorded after the memory freed by reaping
+		defer a.Recorder.alloc(a, mother, sugAddr, sugSize, mode)
+	}
+
+	var res Allocation
+	if err := a.checkSize(mother, sugSize); err != nil {
+		return res, err
+	}
+
+	pref, tol, err := a.placement(mother, sugAddr, mode)
+	if err != nil {
+		return res, err
+	}
+	size := a.flaws.perturb(sugSize)
+
+	for {
+		addr, err := MemAlloc(a.Index, size, pref, tol)
+		if err == nil {
+			res.Segment = Segment{Address: addr, Size: size}
+			return res, nil
+		}
+		if _, full := err.(*NoSpaceError); !full || a.Reaper == nil {
+			return res, err
+		}
+
+		victim, ok := a.Reaper.Reap()
+		if !ok {
+			return res, err
+		}
+		res.Reaped++
+		// all the Segments are freed, the victim is gone in any case
+		var reapErr error
+		for _, s := range victim.Segments {
+			if err := a.Dealloc(s); err != nil {
+				if reapErr == nil {
+					reapErr = errors.Wrapf(err, "reaping cell %d", victim.ID)
+				}
+				continue
+			}
+			res.Freed += s.Size
+		}
+		if reapErr != nil {
+			return res, reapErr
+		}
+	}
+}
+
+// Dealloc returns the memory of seg to the free Frames. Segments that are
+// not entirely inside the soup are rejected with ErrOutOfSoup.
+func (a *Allocator) Dealloc(seg Segment) error {
+	if seg.Address < 0 || seg.Size <= 0 || int64(seg.Address)+int64(seg.Size) > int64(a.Params.SoupSize) {
+		return errors.Wrapf(ErrOutOfSoup, "segment [%d,%d]", seg.Address, seg.Size)
+	}
+	if a.Recorder != nil {
+		a.Recorder.free(a, seg)
+	}
+	return MemDealloc(a.Index, seg.Address, seg.Size)
+}
+
+// Stats returns the statistics of the free memory.
+func (a *Allocator) Stats() ctree.Stats {
+	return indexStats(a.Index)
+}
+
+// checkSize performs the same checks of malchm on the requested size.
+func (a *Allocator) checkSize(mother Segment, size int32) error {
+	p := &a.Params
+	switch {
+	case size <= 0:
+		return errors.Wrapf(ErrInvalidSize, "size %d is not positive", size)
+	case size < p.MinCellSize:
+		return errors.Wrapf(ErrInvalidSize, "size %d is smaller than %d", size, p.MinCellSize)
+	case p.MaxMalMult > 0 && int64(size) > int64(p.MaxMalMult)*int64(mother.Size):
+		return errors.Wrapf(ErrInvalidSize, "size %d is more than %d times the mother size %d",
+			size, p.MaxMalMult, mother.Size)
+	}
+	return nil
+}
+
+// placement maps an allocation mode to the pref and tol parameters of
+// MemAlloc.
+func (a *Allocator) placement(mother Segment, sugAddr int32, mode Mode) (pref, tol int32, err error) {
+	p := &a.Params
+	if p.SoupSize <= 0 {
+		// the soup size is used to pick and wrap addresses
+		return 0, 0, errors.Wrapf(ErrInvalidParams, "soup size %d is not positive", p.SoupSize)
+	}
+	if p.MalTol < 0 || p.AvgSize < 0 {
+		return 0, 0, errors.Wrapf(ErrInvalidParams, "negative tolerance %d x %d", p.MalTol, p.AvgSize)
+	}
+	// a tolerance larger than the soup allows any address, and the product
+	// can overflow
+	tol = int32(min(int64(p.MalTol)*int64(p.AvgSize), int64(p.SoupSize)))
+	switch mode {
+	case FirstFit:
+		return 0, p.SoupSize, nil
+	case BetterFit:
+		return -1, 0, nil
+	case RandomPref:
+		return a.rand.Int31n(p.SoupSize), tol, nil
+	case NearMother:
+		return a.wrap(mother.Address), tol, nil
+	case NearAddress, NearStack:
+		return a.wrap(sugAddr), tol, nil
+	case SuggestedFit:
+		return a.wrap(sugAddr), 0, nil
+	}
+	return 0, 0, errors.Wrapf(ErrInvalidMode, "mode %d", mode)
+}
+
+// wrap brings an address inside the soup, which is circular.
+func (a *Allocator) wrap(addr int32) int32 {
+	addr %= a.Params.SoupSize
+	if addr < 0 {
+		addr += a.Params.SoupSize
+	}
+	return addr
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"testing"
+
+	"github.com/acisternino/gtm/ctree"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+var testParams = Params{
+	SoupSize:    1000,
+	MinCellSize: 10,
+	MaxMalMult:  3,
+	MalTol:      2,
+	AvgSize:     50,
+}
+
+// newTestAllocator returns an Allocator over a soup with free Frames
+// [0,100], [300,50] and [600,400].
+func newTestAllocator() *Allocator {
+	tree := NewTreeIndex(ctree.New(100))
+	tree.Add(&ctree.Frame{Address: 300, Length: 50})
+	tree.Add(&ctree.Frame{Address: 600, Length: 400})
+	return NewAllocator(tree, testParams, 1)
+}
+
+var mother = Segment{Address: 100, Size: 80}
+
+func TestMalFirstFit(t *testing.T) {
+	a := newTestAllocator()
+
+	res, err := a.Mal(mother, 0, 40, FirstFit)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, Segment{Address: 0, Size: 40}, res.Segment)
+	}
+}
+
+func TestMalBetterFit(t *testing.T) {
+	a := newTestAllocator()
+
+	res, err := a.Mal(mother, 0, 40, BetterFit)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, Segment{Address: 300, Size: 40}, res.Segment)
+	}
+}
+
+func TestMalNearMother(t *testing.T) {
+	a := newTestAllocator()
+
+	res, err := a.Mal(Segment{Address: 550, Size: 50}, 0, 40, NearMother)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, int32(600), res.Address)
+	}
+}
+
+func TestMalNearMotherWrap(t *testing.T) {
+	for _, address := range []int32{2550, -450} {
+		a := newTestAllocator()
+
+		res, err := a.Mal(Segment{Address: address, Size: 50}, 0, 40, NearMother)
+
+		if assert.NoError(t, err, "%d", address) {
+			assert.Equal(t, int32(600), res.Address, "%d", address)
+		}
+	}
+}
+
+func TestMalNearAddress(t *testing.T) {
+	a := newTestAllocator()
+
+	res, err := a.Mal(mother, 1250, 40, NearAddress)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, int32(300), res.Address)
+	}
+}
+
+func TestMalSuggested(t *testing.T) {
+	a := newTestAllocator()
+
+	res, err := a.Mal(mother, 700, 40, SuggestedFit)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int32(700), res.Address)
+	}
+
+	_, err = a.Mal(mother, 720, 40, SuggestedFit)
+	assert.IsType(t, &NoSpaceError{}, err)
+}
+
+func TestMalRandomPref(t *testing.T) {
+	a := newTestAllocator()
+	b := newTestAllocator()
+
+	resA, errA := a.Mal(mother, 0, 20, RandomPref)
+	resB, errB := b.Mal(mother, 0, 20, RandomPref)
+
+	if assert.NoError(t, errA) && assert.NoError(t, errB) {
+		assert.Equal(t, resA.Address, resB.Address)
+	}
+}
+
+func TestMalSizeChecks(t *testing.T) {
+	a := newTestAllocator()
+
+	for _, size := range []int32{-1, 0, 5, 241} {
+		_, err := a.Mal(mother, 0, size, BetterFit)
+		assert.Equal(t, ErrInvalidSize, errors.Cause(err), "size %d", size)
+	}
+	assert.Equal(t, 3, a.Index.Len())
+}
+
+func TestMalInvalidMode(t *testing.T) {
+	a := newTestAllocator()
+
+	_, err := a.Mal(mother, 0, 40, Mode(7))
+
+	assert.Equal(t, ErrInvalidMode, errors.Cause(err))
+}
+
+func TestMalInvalidParams(t *testing.T) {
+	for _, mode := range []Mode{RandomPref, NearAddress, SuggestedFit} {
+		a := NewAllocator(NewTreeIndex(ctree.New(100)), Params{}, 1)
+
+		_, err := a.Mal(mother, 10, 40, mode)
+
+		assert.Equal(t, ErrInvalidParams, errors.Cause(err), mode.String())
+	}
+}
+
+func TestMalLargeTolerance(t *testing.T) {
+	p := testParams
+	p.MalTol, p.AvgSize = 50000, 50000
+	a := NewAllocator(NewTreeIndex(ctree.New(100)), p, 1)
+
+	res, err := a.Mal(mother, 900, 40, NearAddress)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, int32(60), res.Address)
+	}
+
+	p.MalTol = -1
+	_, err = NewAllocator(NewTreeIndex(ctree.New(100)), p, 1).Mal(mother, 900, 40, NearAddress)
+	assert.Equal(t, ErrInvalidParams, errors.Cause(err))
+}
+
+func TestMalReap(t *testing.T) {
+	tree := NewTreeIndex(ctree.New(100))
+	a := NewAllocator(tree, testParams, 1)
+	q := &ReapQueue{}
+	a.Reaper = q
+	for id := 1; id <= 3; id++ {
+		res, err := a.Mal(mother, 0, 30, BetterFit)
+		if assert.NoError(t, err) {
+			q.Add(Cell{ID: id, Segments: []Segment{res.Segment}})
+		}
+	}
+
+	res, err := a.Mal(mother, 0, 50, BetterFit)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, res.Reaped)
+		assert.Equal(t, int32(60), res.Freed)
+		assert.Equal(t, Segment{Address: 0, Size: 50}, res.Segment)
+		assert.Equal(t, 1, q.Len())
+	}
+}
+
+func TestMalReapExhausted(t *testing.T) {
+	tree := NewTreeIndex(ctree.New(100))
+	a := NewAllocator(tree, testParams, 1)
+	q := &ReapQueue{}
+	a.Reaper = q
+	res, _ := a.Mal(mother, 0, 30, BetterFit)
+	q.Add(Cell{ID: 1, Segments: []Segment{res.Segment}})
+
+	res, err := a.Mal(mother, 0, 200, BetterFit)
+
+	if assert.Error(t, err) {
+		assert.IsType(t, &NoSpaceError{}, err)
+		assert.Equal(t, 1, res.Reaped)
+		assert.Equal(t, 0, q.Len())
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+// This file contains the port of the functions in memalloc.c
+
+package memory
+
+import (
+	"fmt"
+
+	"github.com/acisternino/gtm/ctree"
+	"github.com/pkg/errors"
+)
+
+// NoSpaceError is returned when none of the free Frames can satisfy an
+// allocation request.
+type NoSpaceError struct {
+	Size int32
+	Pref int32
+	Tol  int32
+}
+
+func (e *NoSpaceError) Error() string {
+	if e.Pref < 0 {
+		return fmt.Sprintf("no free frame of size %d", e.Size)
+	}
+	return fmt.Sprintf("no free frame of size %d at %d±%d", e.Size, e.Pref, e.Tol)
+}
+
+// MemAlloc allocates size slots of memory from the free Frames in index and
+// returns the address of the allocated block.
+//
+// When pref is negative, the Better fit algorithm is used: the smallest Frame
+// that can hold size slots is selected and the block is carved from its left
+// side, i.e. towards smaller addresses.
+//
+// Otherwise a Friendly fit is performed: the block is placed at the free
+// address nearest to pref, provided it is at most tol slots away. Like in
+// Tierra, there is no fallback to other free Frames: if nothing is available
+// within the tolerance the allocation fails and it is up to the caller to
+// make room, e.g. by reaping, or to retry with a wider tolerance.
+func MemAlloc(index FreeIndex, size, pref, tol int32) (int32, error) {
+	if size <= 0 {
+		return 0, errors.Errorf("invalid allocation size %d", size)
+	}
+
+	var f ctree.Frame
+	var address int32
+	var ok bool
+	switch ff, fast := index.(friendlyFitter); {
+	case pref < 0:
+		f, ok = index.Smallest(size)
+		address = f.Address
+	case fast:
+		f, address, ok = ff.FriendlyFit(size, pref, tol)
+	default:
+		f, address, ok = friendlyFit(index, size, pref, tol)
+	}
+	if !ok {
+		return 0, &NoSpaceError{Size: size, Pref: pref, Tol: tol}
+	}
+	return carve(index, f, address, size), nil
+}
+
+// carve takes size slots starting at address out of the free Frame f and
+// returns their address. What is left of f on either side of the block is
+// kept in index.
+func carve(index FreeIndex, f ctree.Frame, address, size int32) int32 {
+	// the Frame length is about to change so it must be taken out of the
+	// index to keep it ordered
+	index.Delete(f)
+
+	if address > f.Address {
+		index.Insert(ctree.Frame{Address: f.Address, Length: address - f.Address})
+	}
+	if rest := f.Address + f.Length - address - size; rest > 0 {
+		index.Insert(ctree.Frame{Address: address + size, Length: rest})
+	}
+	return address
+}
+
+// MemDealloc returns size slots starting at address to the free Frames in
+// index. The new Frame is merged with any free Frame it touches.
+// Freeing memory that is already free, even partially, is an error, and so
+// is a negative address.
+func MemDealloc(index FreeIndex, address, size int32) error {
+	if address < 0 {
+		return errors.Errorf("invalid deallocation address %d", address)
+	}
+	if size <= 0 {
+		return errors.Errorf("invalid deallocation size %d", size)
+	}
+	if err := coalesce(index, ctree.Frame{Address: address, Length: size}); err != nil {
+		return errors.Wrapf(err, "double free of %d slots at %d", size, address)
+	}
+	return nil
+}
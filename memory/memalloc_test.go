@@ -0,0 +1,145 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"testing"
+
+	"github.com/acisternino/gtm/ctree"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemAllocLeftSide(t *testing.T) {
+	tree := NewTreeIndex(ctree.New(100))
+
+	addr, err := MemAlloc(tree, 30, -1, 0)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, int32(0), addr)
+		assert.Equal(t, 1, tree.Frames)
+		assert.Equal(t, "[30,70]", tree.BetterFit(1).String())
+	}
+}
+
+func TestMemAllocBetterFit(t *testing.T) {
+	tree := NewTreeIndex(ctree.New(100))
+	tree.Add(&ctree.Frame{Address: 200, Length: 20})
+	tree.Add(&ctree.Frame{Address: 300, Length: 40})
+
+	addr, err := MemAlloc(tree, 25, -1, 0)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, int32(300), addr)
+		assert.Equal(t, 3, tree.Frames)
+		assert.Equal(t, "[325,15]", tree.BetterFit(1).String())
+	}
+}
+
+func TestMemAllocExact(t *testing.T) {
+	tree := NewTreeIndex(ctree.New(100))
+	tree.Add(&ctree.Frame{Address: 200, Length: 20})
+
+	addr, err := MemAlloc(tree, 20, -1, 0)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, int32(200), addr)
+		assert.Equal(t, 1, tree.Frames)
+	}
+}
+
+func TestMemAllocNoSpace(t *testing.T) {
+	tree := NewTreeIndex(ctree.New(100))
+
+	_, err := MemAlloc(tree, 101, -1, 0)
+
+	if assert.Error(t, err) {
+		assert.IsType(t, &NoSpaceError{}, err)
+		assert.Equal(t, 1, tree.Frames)
+	}
+}
+
+func TestMemAllocInvalidSize(t *testing.T) {
+	tree := NewTreeIndex(ctree.New(100))
+
+	_, err := MemAlloc(tree, 0, -1, 0)
+
+	assert.Error(t, err)
+}
+
+func TestMemDealloc(t *testing.T) {
+	tree := NewTreeIndex(ctree.New(100))
+	a, _ := MemAlloc(tree, 30, -1, 0)
+	b, _ := MemAlloc(tree, 30, -1, 0)
+
+	err := MemDealloc(tree, a, 30)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, tree.Frames)
+	}
+
+	err = MemDealloc(tree, b, 30)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, tree.Frames)
+		assert.Equal(t, "[0,100]", tree.BetterFit(100).String())
+	}
+}
+
+func TestMemDeallocDoubleFree(t *testing.T) {
+	tree := NewTreeIndex(ctree.New(100))
+	a, _ := MemAlloc(tree, 30, -1, 0)
+	MemDealloc(tree, a, 30)
+
+	err := MemDealloc(tree, a, 30)
+
+	if assert.Error(t, err) {
+		assert.IsType(t, &ctree.OverlapError{}, errors.Cause(err))
+		assert.Equal(t, 1, tree.Frames)
+	}
+}
+
+func TestMemAllocFriendlyFit(t *testing.T) {
+	tree := NewTreeIndex(ctree.New(100))
+
+	addr, err := MemAlloc(tree, 20, 50, 10)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, int32(50), addr)
+		assert.Equal(t, 2, tree.Frames)
+		assert.Equal(t, "[0,50]", tree.BetterFit(50).String())
+		assert.Equal(t, "[70,30]", tree.BetterFit(30).String())
+	}
+}
+
+func TestMemAllocFriendlyFitNearest(t *testing.T) {
+	tree := NewTreeIndex(ctree.New(100))
+	MemAlloc(tree, 40, 30, 0) // [0,30] [70,30]
+
+	addr, err := MemAlloc(tree, 20, 45, 30)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, int32(70), addr)
+		assert.Equal(t, "[90,10]", tree.BetterFit(10).String())
+	}
+}
+
+func TestMemAllocFriendlyFitTolerance(t *testing.T) {
+	tree := NewTreeIndex(ctree.New(100))
+	MemAlloc(tree, 40, 30, 0) // [0,30] [70,30]
+
+	_, err := MemAlloc(tree, 20, 45, 10)
+
+	if assert.Error(t, err) {
+		assert.EqualError(t, err, "no free frame of size 20 at 45±10")
+		assert.Equal(t, 2, tree.Frames)
+	}
+}
+
+func TestMemDeallocNegativeAddress(t *testing.T) {
+	tree := NewTreeIndex(ctree.New(100))
+
+	assert.Error(t, MemDealloc(tree, -2147483000, 10))
+	assert.Equal(t, 1, tree.Frames)
+	assert.NoError(t, MemDealloc(tree, 2147483000, 10))
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+// This file contains the memory protection of the soup
+
+package memory
+
+import "fmt"
+
+// Access is a set of memory access kinds.
+type Access uint8
+
+// Access kinds. The values are the same bits used by the MemMode parameters
+// of Tierra.
+const (
+	Exec Access = 1 << iota
+	Write
+	Read
+)
+
+func (a Access) String() string {
+	s := []byte("---")
+	if a&Read != 0 {
+		s[0] = 'r'
+	}
+	if a&Write != 0 {
+		s[1] = 'w'
+	}
+	if a&Exec != 0 {
+		s[2] = 'x'
+	}
+	return string(s)
+}
+
+// Policy contains the accesses that are forbidden to a cell, depending on
+// who owns the memory being accessed. It corresponds to the MemModeFree,
+// MemModeMine and MemModeProt parameters of Tierra.
+type Policy struct {
+	Free  Access // protection of free memory
+	Mine  Access // protection of memory owned by the cell
+	Other Access // protection of memory owned by other cells
+}
+
+// DefaultPolicy returns the Tierra default: cells can read and execute
+// anywhere but they can only write into their own memory, which includes
+// the space allocated for their daughter, and into free memory.
+func DefaultPolicy() Policy {
+	return Policy{Other: Write}
+}
+
+// ViolationError is returned when a cell attempts a forbidden access.
+type ViolationError struct {
+	Cell    int    // the cell performing the access
+	Address int32  // the address being accessed
+	Access  Access // the kind of access
+	Owner   int    // the owner of the address, if any
+	Free    bool   // the address is not allocated
+}
+
+func (e *ViolationError) Error() string {
+	if e.Free {
+		return fmt.Sprintf("cell %d: %v access to free address %d", e.Cell, e.Access, e.Address)
+	}
+	return fmt.Sprintf("cell %d: %v access to address %d of cell %d", e.Cell, e.Access, e.Address, e.Owner)
+}
+
+// Check verifies that cell can perform the given access at address according
+// to the soup Policy. A *ViolationError is returned if the access is denied.
+func (s *Soup) Check(cell int, address int32, acc Access) error {
+	if err := s.check(Segment{Address: address, Size: 1}); err != nil {
+		return err
+	}
+
+	b, allocated := s.Ledger.Owner(address)
+	prot := s.Policy.Free
+	switch {
+	case allocated && b.Owner == cell:
+		prot = s.Policy.Mine
+	case allocated:
+		prot = s.Policy.Other
+	}
+
+	if denied := acc & prot; denied != 0 {
+		return &ViolationError{
+			Cell:    cell,
+			Address: address,
+			Access:  denied,
+			Owner:   b.Owner,
+			Free:    !allocated,
+		}
+	}
+	return nil
+}
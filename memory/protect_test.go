@@ -0,0 +1,66 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// newProtectedSoup returns a soup where cell 1 owns [0,50] and cell 2
+// owns [50,50].
+func newProtectedSoup() *Soup {
+	s, _ := NewSoup(1000)
+	s.Mal(1, mother, 0, 50, FirstFit)
+	s.Mal(2, mother, 0, 50, FirstFit)
+	return s
+}
+
+func TestAccessString(t *testing.T) {
+	assert.Equal(t, "---", Access(0).String())
+	assert.Equal(t, "r-x", (Read | Exec).String())
+	assert.Equal(t, "rwx", (Read | Write | Exec).String())
+}
+
+func TestCheckDefaultPolicy(t *testing.T) {
+	s := newProtectedSoup()
+
+	assert.NoError(t, s.Check(1, 10, Read|Write|Exec))
+	assert.NoError(t, s.Check(1, 60, Read|Exec))
+	assert.NoError(t, s.Check(1, 500, Read|Write|Exec))
+
+	err := s.Check(1, 60, Write)
+	if assert.IsType(t, &ViolationError{}, err) {
+		v := err.(*ViolationError)
+		assert.Equal(t, 2, v.Owner)
+		assert.False(t, v.Free)
+		assert.EqualError(t, err, "cell 1: -w- access to address 60 of cell 2")
+	}
+}
+
+func TestCheckCustomPolicy(t *testing.T) {
+	s := newProtectedSoup()
+	s.Policy = Policy{Free: Write | Exec, Mine: 0, Other: Read | Write}
+
+	err := s.Check(2, 500, Read|Exec)
+	if assert.IsType(t, &ViolationError{}, err) {
+		assert.EqualError(t, err, "cell 2: --x access to free address 500")
+	}
+
+	err = s.Check(2, 10, Read|Exec)
+	assert.EqualError(t, err, "cell 2: r-- access to address 10 of cell 1")
+
+	assert.NoError(t, s.Check(2, 60, Read|Write|Exec))
+}
+
+func TestCheckOutOfSoup(t *testing.T) {
+	s := newProtectedSoup()
+
+	err := s.Check(1, 1000, Read)
+
+	assert.Equal(t, ErrOutOfSoup, errors.Cause(err))
+}
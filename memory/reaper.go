@@ -0,0 +1,61 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+// This file contains the interface to the reaper of tierra.c
+
+package memory
+
+// Cell is a living cell together with the memory it owns.
+type Cell struct {
+	ID       int
+	Segments []Segment
+}
+
+// Reaper keeps the queue of living cells ordered by reap priority.
+// When the soup is full, Mal asks the Reaper for victims and frees their
+// memory until the allocation succeeds or no victims are left.
+type Reaper interface {
+	// Reap removes the cell with the highest reap priority from the queue
+	// and returns it. ok is false if the queue is empty.
+	Reap() (c Cell, ok bool)
+}
+
+// ReapQueue is a simple Reaper where cells are reaped in the same order
+// they were added, i.e. oldest first.
+type ReapQueue struct {
+	cells []Cell
+}
+
+// Add appends c at the bottom of the queue.
+func (q *ReapQueue) Add(c Cell) {
+	q.cells = append(q.cells, c)
+}
+
+// Remove takes the cell with the given ID out of the queue, e.g. because it
+// died of other causes. It returns false if there is no such cell.
+func (q *ReapQueue) Remove(id int) bool {
+	for i, c := range q.cells {
+		if c.ID == id {
+			q.cells = append(q.cells[:i], q.cells[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Len returns the number of cells in the queue.
+func (q *ReapQueue) Len() int {
+	return len(q.cells)
+}
+
+// Reap implements Reaper.
+func (q *ReapQueue) Reap() (Cell, bool) {
+	if len(q.cells) == 0 {
+		return Cell{}, false
+	}
+	c := q.cells[0]
+	q.cells[0] = Cell{}
+	q.cells = q.cells[1:]
+	return c, true
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReapQueueOrder(t *testing.T) {
+	q := &ReapQueue{}
+	q.Add(Cell{ID: 1})
+	q.Add(Cell{ID: 2})
+	q.Add(Cell{ID: 3})
+
+	for _, id := range []int{1, 2, 3} {
+		c, ok := q.Reap()
+		if assert.True(t, ok) {
+			assert.Equal(t, id, c.ID)
+		}
+	}
+
+	_, ok := q.Reap()
+	assert.False(t, ok)
+}
+
+func TestReapQueueRemove(t *testing.T) {
+	q := &ReapQueue{}
+	q.Add(Cell{ID: 1})
+	q.Add(Cell{ID: 2})
+
+	assert.True(t, q.Remove(1))
+	assert.False(t, q.Remove(1))
+	assert.Equal(t, 1, q.Len())
+
+	c, _ := q.Reap()
+	assert.Equal(t, 2, c.ID)
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+// This file contains a FreeIndex made of segregated free lists
+
+package memory
+
+import (
+	"math/bits"
+
+	"github.com/acisternino/gtm/ctree"
+)
+
+// SegregatedIndex keeps the free Frames in lists of similar size, as many
+// malloc implementations do. The Frames in list i have a length between
+// 2^i and 2^(i+1)-1, so a search only scans the lists that can hold the
+// requested size. The lists are not sorted and Smallest scans the first
+// list that has a large enough Frame.
+// A balanced tree of the same Frames by address is used for looking up the
+// neighbours.
+type SegregatedIndex struct {
+	addressIndex
+	lists [][]ctree.Frame
+	slot  map[int32]int // position of the Frames in their list, by address
+}
+
+// NewSegregatedIndex returns an empty SegregatedIndex.
+func NewSegregatedIndex() *SegregatedIndex {
+	return &SegregatedIndex{
+		addressIndex: newAddressIndex(),
+		slot:         make(map[int32]int),
+	}
+}
+
+// class returns the list of the Frames of the given length.
+func class(length int32) int {
+	return bits.Len32(uint32(length)) - 1
+}
+
+// Insert implements FreeIndex.
+func (x *SegregatedIndex) Insert(f ctree.Frame) {
+	c := class(f.Length)
+	for len(x.lists) <= c {
+		x.lists = append(x.lists, nil)
+	}
+	x.slot[f.Address] = len(x.lists[c])
+	x.lists[c] = append(x.lists[c], f)
+	x.frames.insert(f)
+}
+
+// Delete implements FreeIndex.
+func (x *SegregatedIndex) Delete(f ctree.Frame) error {
+	if g, ok := x.find(f.Address); !ok || g != f {
+		return ctree.ErrFrameNotFound
+	}
+	list := x.lists[class(f.Length)]
+	i, last := x.slot[f.Address], len(list)-1
+	list[i] = list[last]
+	x.slot[list[i].Address] = i
+	x.lists[class(f.Length)] = list[:last]
+	delete(x.slot, f.Address)
+	x.frames.delete(f)
+	return nil
+}
+
+// Smallest implements FreeIndex.
+func (x *SegregatedIndex) Smallest(size int32) (ctree.Frame, bool) {
+	for c := class(max(size, 1)); c < len(x.lists); c++ {
+		var best ctree.Frame
+		for _, f := range x.lists[c] {
+			if f.Length >= size && (best.Length == 0 || byLength(f, best)) {
+				best = f
+			}
+		}
+		if best.Length > 0 {
+			return best, true
+		}
+	}
+	return ctree.Frame{}, false
+}
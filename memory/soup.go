@@ -0,0 +1,200 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+// This file contains the soup: the memory where cells live
+
+package memory
+
+import (
+	"github.com/acisternino/gtm/ctree"
+	"github.com/pkg/errors"
+)
+
+// ErrOutOfSoup is the cause of errors returned when accessing memory
+// outside the soup.
+var ErrOutOfSoup = errors.New("out of soup")
+
+// DefaultParams returns the allocation parameters used by Tierra for a soup
+// of the given size.
+func DefaultParams(size int32) Params {
+	return Params{
+		SoupSize:    size,
+		MinCellSize: 12,
+		MaxMalMult:  3,
+		MalTol:      20,
+		AvgSize:     80,
+	}
+}
+
+// Soup is the memory of the simulation. It owns the instructions of the
+// cells, the index of free Frames, the Allocator working on it and the Ledger
+// of the allocated Blocks.
+// The Allocator is not exposed: all the memory goes through the Ledger.
+type Soup struct {
+	Ledger *Ledger
+
+	// Reaper selects the victims when the soup is full. The memory of the
+	// victims is taken from the Ledger and their Segments are ignored.
+	Reaper Reaper
+
+	// Policy controls the accesses allowed by Check.
+	Policy Policy
+
+	// Time is the current time of the simulation. It is recorded in the
+	// allocated Blocks.
+	Time int64
+
+	alloc *Allocator
+	cells []byte
+	used  int32
+}
+
+// NewSoup returns an empty soup of the given size with default parameters.
+func NewSoup(size int32) (*Soup, error) {
+	return NewSoupWithParams(DefaultParams(size), 0)
+}
+
+// NewSoupWithParams returns an empty soup with the given parameters.
+// The seed initializes the random generator of the Allocator. The free
+// memory is kept in an index of the kind selected by p.Index.
+// An error is returned if the size of the soup is not positive or the kind
+// of index is not valid.
+func NewSoupWithParams(p Params, seed int64) (*Soup, error) {
+	if p.SoupSize <= 0 {
+		return nil, errors.Wrapf(ErrInvalidParams, "soup size %d is not positive", p.SoupSize)
+	}
+	index, err := NewFreeIndex(p.Index, p.SoupSize)
+	if err != nil {
+		return nil, err
+	}
+	s := &Soup{
+		Ledger: NewLedger(),
+		Policy: DefaultPolicy(),
+		alloc:  NewAllocator(index, p, seed),
+		cells:  make([]byte, p.SoupSize),
+	}
+	s.alloc.Reaper = soupReaper{s}
+	return s, nil
+}
+
+// Params returns the allocation parameters of the soup.
+func (s *Soup) Params() Params {
+	return s.alloc.Params
+}
+
+// Stats returns the statistics of the free memory.
+func (s *Soup) Stats() ctree.Stats {
+	return s.alloc.Stats()
+}
+
+// Record writes all the following allocation requests to r as a trace.
+// A nil Recorder stops the recording.
+func (s *Soup) Record(r *Recorder) {
+	s.alloc.Recorder = r
+}
+
+// Size returns the number of slots in the soup.
+func (s *Soup) Size() int32 {
+	return int32(len(s.cells))
+}
+
+// Used returns the number of allocated slots.
+func (s *Soup) Used() int32 {
+	return s.used
+}
+
+// Mal allocates memory in the soup like Allocator.Mal and records the new
+// Block as owned by the given cell.
+func (s *Soup) Mal(owner int, mother Segment, sugAddr, sugSize int32, mode Mode) (Allocation, error) {
+	res, err := s.alloc.Mal(mother, sugAddr, sugSize, mode)
+	s.used -= res.Freed
+	if err != nil {
+		return res, err
+	}
+	s.used += res.Size
+	return res, s.Ledger.Add(Block{Segment: res.Segment, Owner: owner, Time: s.Time})
+}
+
+// Free returns to the soup the Block starting at address. The Block stays in
+// the Ledger if its memory can not be freed.
+func (s *Soup) Free(address int32) error {
+	b, ok := s.Ledger.Owner(address)
+	if !ok || b.Address != address {
+		return errors.Errorf("no block allocated at %d", address)
+	}
+	return s.free(b)
+}
+
+// FreeCell returns to the soup all the Blocks owned by a cell. All the Blocks
+// are freed also in case of errors, the first error is returned and the
+// Blocks that can not be freed stay in the Ledger.
+func (s *Soup) FreeCell(owner int) error {
+	var first error
+	for _, b := range s.Ledger.Blocks(owner) {
+		if err := s.free(b); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// free returns the memory of b to the index of free Frames and then removes
+// b from the Ledger.
+func (s *Soup) free(b Block) error {
+	if err := s.alloc.Dealloc(b.Segment); err != nil {
+		return err
+	}
+	s.Ledger.Remove(b.Address)
+	s.used -= b.Size
+	return nil
+}
+
+// Read returns a copy of the instructions in seg.
+func (s *Soup) Read(seg Segment) ([]byte, error) {
+	if err := s.check(seg); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, seg.Size)
+	copy(buf, s.cells[seg.Address:])
+	return buf, nil
+}
+
+// Write copies data into the soup starting at address.
+func (s *Soup) Write(address int32, data []byte) error {
+	if err := s.check(Segment{Address: address, Size: int32(len(data))}); err != nil {
+		return err
+	}
+	copy(s.cells[address:], data)
+	return nil
+}
+
+// check verifies that seg is entirely inside the soup.
+func (s *Soup) check(seg Segment) error {
+	if seg.Address < 0 || seg.Size < 0 || int64(seg.Address)+int64(seg.Size) > int64(len(s.cells)) {
+		return errors.Wrapf(ErrOutOfSoup, "segment [%d,%d]", seg.Address, seg.Size)
+	}
+	return nil
+}
+
+// soupReaper is the Reaper seen by the Allocator of a Soup. It takes the
+// victims from the Soup Reaper and their memory from the Ledger.
+type soupReaper struct {
+	s *Soup
+}
+
+func (r soupReaper) Reap() (Cell, bool) {
+	if r.s.Reaper == nil {
+		return Cell{}, false
+	}
+	c, ok := r.s.Reaper.Reap()
+	if !ok {
+		return c, false
+	}
+	blocks := r.s.Ledger.RemoveOwner(c.ID)
+	c.Segments = make([]Segment, len(blocks))
+	for i, b := range blocks {
+		c.Segments[i] = b.Segment
+	}
+	return c, true
+}
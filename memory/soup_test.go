@@ -0,0 +1,135 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSoup(t *testing.T) {
+	s, _ := NewSoup(1000)
+
+	assert.Equal(t, int32(1000), s.Size())
+	assert.Equal(t, int32(0), s.Used())
+	assert.Equal(t, 1, s.Stats().Frames)
+}
+
+func TestSoupMalFree(t *testing.T) {
+	s, _ := NewSoup(1000)
+	s.Time = 42
+
+	res, err := s.Mal(1, mother, 0, 80, BetterFit)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int32(80), s.Used())
+		b, ok := s.Ledger.Owner(res.Address + 10)
+		if assert.True(t, ok) {
+			assert.Equal(t, Block{Segment: res.Segment, Owner: 1, Time: 42}, b)
+		}
+	}
+
+	err = s.Free(res.Address)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int32(0), s.Used())
+		assert.Equal(t, 0, s.Ledger.Len())
+		assert.Equal(t, 1, s.Stats().Frames)
+	}
+
+	assert.Error(t, s.Free(res.Address))
+}
+
+func TestSoupFreeCellError(t *testing.T) {
+	s, _ := NewSoup(1000)
+	// a Block whose memory is still free
+	s.Ledger.Add(Block{Segment: Segment{Address: 500, Size: 40}, Owner: 1})
+	res, _ := s.Mal(1, mother, 0, 80, BetterFit)
+
+	assert.Error(t, s.Free(500))
+	assert.Equal(t, 2, s.Ledger.Len())
+
+	err := s.FreeCell(1)
+
+	assert.Error(t, err)
+	assert.Equal(t, int32(0), s.Used())
+	assert.Equal(t, []Block{{Segment: Segment{Address: 500, Size: 40}, Owner: 1}}, s.Ledger.Blocks(1))
+	_, ok := s.Ledger.Owner(res.Address)
+	assert.False(t, ok)
+	assert.Equal(t, int64(1000), s.Stats().Free)
+}
+
+func TestSoupFreeCell(t *testing.T) {
+	s, _ := NewSoup(1000)
+	s.Mal(1, mother, 0, 80, BetterFit)
+	s.Mal(2, mother, 0, 80, BetterFit)
+	s.Mal(1, mother, 0, 80, BetterFit)
+
+	err := s.FreeCell(1)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, int32(80), s.Used())
+		assert.Equal(t, 1, s.Ledger.Len())
+		assert.Len(t, s.Ledger.Blocks(2), 1)
+	}
+}
+
+func TestSoupMalReap(t *testing.T) {
+	s, _ := NewSoup(100)
+	q := &ReapQueue{}
+	s.Reaper = q
+	s.Mal(1, mother, 0, 60, BetterFit)
+	q.Add(Cell{ID: 1})
+
+	res, err := s.Mal(2, mother, 0, 50, BetterFit)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, res.Reaped)
+		assert.Equal(t, int32(50), s.Used())
+		assert.Empty(t, s.Ledger.Blocks(1))
+		assert.Len(t, s.Ledger.Blocks(2), 1)
+	}
+}
+
+func TestSoupMalReapError(t *testing.T) {
+	s, _ := NewSoup(100)
+	q := &ReapQueue{}
+	s.Reaper = q
+	// a Block whose memory is still free
+	s.Ledger.Add(Block{Segment: Segment{Address: 70, Size: 10}, Owner: 1})
+	s.Mal(1, mother, 0, 60, BetterFit)
+	q.Add(Cell{ID: 1})
+
+	res, err := s.Mal(2, mother, 0, 50, BetterFit)
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, res.Reaped)
+	assert.Equal(t, int32(60), res.Freed)
+	assert.Equal(t, int32(0), s.Used())
+	assert.Equal(t, int64(100), s.Stats().Free)
+}
+
+func TestSoupReadWrite(t *testing.T) {
+	s, _ := NewSoup(100)
+
+	err := s.Write(10, []byte{1, 2, 3})
+	if assert.NoError(t, err) {
+		data, err := s.Read(Segment{Address: 9, Size: 5})
+		if assert.NoError(t, err) {
+			assert.Equal(t, []byte{0, 1, 2, 3, 0}, data)
+		}
+	}
+}
+
+func TestSoupOutOfBounds(t *testing.T) {
+	s, _ := NewSoup(100)
+
+	err := s.Write(98, []byte{1, 2, 3})
+	assert.Equal(t, ErrOutOfSoup, errors.Cause(err))
+
+	_, err = s.Read(Segment{Address: -1, Size: 5})
+	assert.Equal(t, ErrOutOfSoup, errors.Cause(err))
+
+}
@@ -0,0 +1,304 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+// This file contains code for reading the allocations of Tierra runs and
+// comparing them with the decisions of the Allocator
+
+package memory
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Tierra does not log its allocations in a form that can be replayed, so the
+// records are in a format defined by gtm. They must be written by a Tierra
+// instrumented to print a line for each successful mal instruction and for
+// each birth and death of a cell.
+//
+// A record file contains one record per line. Each record starts with the
+// time of the event and its kind, followed by key=value fields:
+//
+//	<time> mal mother=<id> maddr=<address> msize=<size> cell=<id> mode=<mode> size=<size> sug=<address> addr=<address>
+//	<time> birth cell=<id> addr=<address> size=<size>
+//	<time> death cell=<id> addr=<address> size=<size>
+//
+// A mal record is a successful allocation of the block of a daughter cell;
+// addr is the address chosen by Tierra. A birth record of a cell that has not
+// been allocated is the inoculation of a cell in the soup. A death record
+// frees the memory of a cell, including the deaths caused by the reaper which
+// are logged before the mal that caused them.
+// Empty lines, lines starting with # and unknown fields are ignored.
+
+// TierraKind is the kind of a Tierra record.
+type TierraKind int
+
+// Kinds of Tierra records.
+const (
+	TierraMal TierraKind = iota
+	TierraBirth
+	TierraDeath
+)
+
+var tierraKinds = [...]string{
+	TierraMal:   "mal",
+	TierraBirth: "birth",
+	TierraDeath: "death",
+}
+
+func (k TierraKind) String() string {
+	if k >= 0 && int(k) < len(tierraKinds) {
+		return tierraKinds[k]
+	}
+	return fmt.Sprintf("TierraKind(%d)", int(k))
+}
+
+// TierraRecord is an event of a Tierra run.
+type TierraRecord struct {
+	Line int // line of the record file
+	Time int64
+	Kind TierraKind
+
+	Cell    int     // the daughter for mal records
+	Segment Segment // memory of the cell
+
+	// only for mal records
+	MotherCell int
+	Mother     Segment // memory of the mother
+	Mode       Mode
+	SugAddr    int32
+}
+
+func (r TierraRecord) String() string {
+	if r.Kind == TierraMal {
+		return fmt.Sprintf("%d mal mother=%d maddr=%d msize=%d cell=%d mode=%d size=%d sug=%d addr=%d",
+			r.Time, r.MotherCell, r.Mother.Address, r.Mother.Size, r.Cell, int(r.Mode),
+			r.Segment.Size, r.SugAddr, r.Segment.Address)
+	}
+	return fmt.Sprintf("%d %v cell=%d addr=%d size=%d", r.Time, r.Kind, r.Cell, r.Segment.Address, r.Segment.Size)
+}
+
+// ReadTierraRecords reads all the records of a record file. Errors have
+// ErrTrace as their cause.
+func ReadTierraRecords(r io.Reader) ([]TierraRecord, error) {
+	var records []TierraRecord
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		rec, err := parseTierraRecord(fields)
+		if err != nil {
+			return records, errors.Wrapf(ErrTrace, "line %d: %v", line, err)
+		}
+		rec.Line = line
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
+
+// parseTierraRecord parses the fields of a line of a record file.
+func parseTierraRecord(fields []string) (TierraRecord, error) {
+	var rec TierraRecord
+	if len(fields) < 2 {
+		return rec, errors.New("missing record kind")
+	}
+	t, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return rec, errors.Errorf("bad time %q", fields[0])
+	}
+	rec.Time = t
+
+	values := make(map[string]string)
+	for _, f := range fields[2:] {
+		if i := strings.IndexByte(f, '='); i > 0 {
+			values[f[:i]] = f[i+1:]
+		}
+	}
+	var keys []string
+	ints := map[string]*int32{
+		"addr": &rec.Segment.Address,
+		"size": &rec.Segment.Size,
+	}
+	switch fields[1] {
+	case "mal":
+		rec.Kind = TierraMal
+		keys = []string{"mother", "maddr", "msize", "cell", "mode", "size", "sug", "addr"}
+		ints["maddr"] = &rec.Mother.Address
+		ints["msize"] = &rec.Mother.Size
+		ints["sug"] = &rec.SugAddr
+	case "birth":
+		rec.Kind = TierraBirth
+		keys = []string{"cell", "addr", "size"}
+	case "death":
+		rec.Kind = TierraDeath
+		keys = []string{"cell", "addr", "size"}
+	default:
+		return rec, errors.Errorf("unknown record %q", fields[1])
+	}
+
+	for _, k := range keys {
+		v, ok := values[k]
+		if !ok {
+			return rec, errors.Errorf("%s record without %s", fields[1], k)
+		}
+		if k == "mode" {
+			if rec.Mode, err = ParseMode(v); err != nil {
+				return rec, err
+			}
+			continue
+		}
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return rec, errors.Errorf("bad %s %q", k, v)
+		}
+		switch k {
+		case "cell":
+			rec.Cell = int(n)
+		case "mother":
+			rec.MotherCell = int(n)
+		default:
+			*ints[k] = int32(n)
+		}
+	}
+	return rec, nil
+}
+
+// TierraOps converts Tierra records to the requests of a trace that follows
+// the memory of the Tierra run. Mal records become SuggestedFit allocations
+// at the address chosen by Tierra, so that deaths free the blocks that have
+// been allocated. Births of cells that have been allocated are not memory
+// requests and are dropped.
+func TierraOps(records []TierraRecord) []Op {
+	ops := make([]Op, 0, len(records))
+	allocated := make(map[int]bool)
+	for _, r := range records {
+		op := Op{Line: r.Line}
+		switch r.Kind {
+		case TierraMal:
+			allocated[r.Cell] = true
+			op.Kind, op.Size, op.Mode, op.Mother, op.SugAddr = OpAlloc, r.Segment.Size, SuggestedFit, r.Mother, r.Segment.Address
+		case TierraBirth:
+			if allocated[r.Cell] {
+				continue
+			}
+			allocated[r.Cell] = true
+			op.Kind, op.Size, op.Mode, op.Mother, op.SugAddr = OpAlloc, r.Segment.Size, SuggestedFit, r.Segment, r.Segment.Address
+		case TierraDeath:
+			delete(allocated, r.Cell)
+			op.Kind, op.Segment = OpFree, r.Segment
+		}
+		ops = append(ops, op)
+	}
+	return ops
+}
+
+// Mismatch is a Tierra record where the Allocator did not do the same as
+// Tierra.
+type Mismatch struct {
+	Record  TierraRecord
+	Address int32 // address chosen by the Allocator
+	Err     error // error returned by the Allocator
+}
+
+func (m Mismatch) String() string {
+	if m.Err != nil {
+		return fmt.Sprintf("line %d: %v: %v", m.Record.Line, m.Record.Kind, m.Err)
+	}
+	return fmt.Sprintf("line %d: cell %d allocated at %d instead of %d",
+		m.Record.Line, m.Record.Cell, m.Address, m.Record.Segment.Address)
+}
+
+// TierraReport is the outcome of CompareTierra.
+type TierraReport struct {
+	Mals       int // number of mal records
+	Matches    int // mal records where the Allocator chose the same address
+	Mismatches []Mismatch
+}
+
+func (r *TierraReport) String() string {
+	var buf bytes.Buffer
+	for _, m := range r.Mismatches {
+		fmt.Fprintln(&buf, m)
+	}
+	fmt.Fprintf(&buf, "%d of %d allocations at the same address, %d mismatches",
+		r.Matches, r.Mals, len(r.Mismatches))
+	return buf.String()
+}
+
+// CompareTierra replays Tierra records on a and reports where its decisions
+// differ from the ones of Tierra.
+//
+// After the first difference the memory of the two runs is not the same
+// anymore. To keep the comparison meaningful the Allocator works on its own
+// blocks: mothers are taken at the address chosen by the Allocator and dead
+// cells free the block the Allocator gave them. Daughters that the
+// Allocator failed to allocate are reported once, their birth and death are
+// skipped.
+func CompareTierra(a *Allocator, records []TierraRecord) *TierraReport {
+	report := &TierraReport{}
+	cells := make(map[int]Segment)
+	failed := make(map[int]bool)
+	mismatch := func(r TierraRecord, addr int32, err error) {
+		report.Mismatches = append(report.Mismatches, Mismatch{Record: r, Address: addr, Err: err})
+	}
+
+	for _, r := range records {
+		switch r.Kind {
+		case TierraMal:
+			report.Mals++
+			mother, ok := cells[r.MotherCell]
+			if !ok {
+				mother = r.Mother
+			}
+			res, err := a.Mal(mother, r.SugAddr, r.Segment.Size, r.Mode)
+			switch {
+			case err != nil:
+				mismatch(r, 0, err)
+				failed[r.Cell] = true
+			case res.Address != r.Segment.Address:
+				mismatch(r, res.Address, nil)
+				cells[r.Cell] = res.Segment
+			default:
+				report.Matches++
+				cells[r.Cell] = res.Segment
+			}
+		case TierraBirth:
+			if _, ok := cells[r.Cell]; ok || failed[r.Cell] {
+				continue
+			}
+			// inoculation, the cell must be exactly where Tierra put it
+			res, err := a.Mal(r.Segment, r.Segment.Address, r.Segment.Size, SuggestedFit)
+			if err != nil {
+				mismatch(r, 0, err)
+				continue
+			}
+			cells[r.Cell] = res.Segment
+		case TierraDeath:
+			if failed[r.Cell] {
+				delete(failed, r.Cell)
+				continue
+			}
+			seg, ok := cells[r.Cell]
+			if !ok {
+				mismatch(r, 0, errors.Errorf("death of unknown cell %d", r.Cell))
+				continue
+			}
+			delete(cells, r.Cell)
+			if err := a.Dealloc(seg); err != nil {
+				mismatch(r, seg.Address, err)
+			}
+		}
+	}
+	return report
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/acisternino/gtm/ctree"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+const tierraRecords = `# inoculation
+0 birth cell=1 addr=0 size=80
+10 mal mother=1 maddr=0 msize=80 cell=2 mode=1 size=80 sug=0 addr=80 extra=x
+12 birth cell=2 addr=80 size=80
+
+20 mal mother=2 maddr=80 msize=80 cell=3 mode=3 size=40 sug=0 addr=500
+25 death cell=1 addr=0 size=80
+30 mal mother=2 maddr=80 msize=80 cell=4 mode=1 size=60 sug=0 addr=0
+`
+
+func TestReadTierraRecords(t *testing.T) {
+	records, err := ReadTierraRecords(strings.NewReader(tierraRecords))
+
+	if assert.NoError(t, err) && assert.Len(t, records, 6) {
+		assert.Equal(t, TierraRecord{Line: 2, Kind: TierraBirth, Cell: 1, Segment: Segment{0, 80}}, records[0])
+		assert.Equal(t, TierraRecord{
+			Line: 3, Time: 10, Kind: TierraMal, Cell: 2, Segment: Segment{80, 80},
+			MotherCell: 1, Mother: Segment{0, 80}, Mode: BetterFit,
+		}, records[1])
+		assert.Equal(t, "25 death cell=1 addr=0 size=80", records[4].String())
+		assert.Equal(t, "20 mal mother=2 maddr=80 msize=80 cell=3 mode=3 size=40 sug=0 addr=500", records[3].String())
+	}
+}
+
+func TestReadTierraRecordsErrors(t *testing.T) {
+	for _, log := range []string{
+		"10",
+		"x birth cell=1 addr=0 size=80",
+		"10 split cell=1",
+		"10 birth cell=1 addr=0",
+		"10 death cell=1 addr=0 size=big",
+		"10 mal mother=1 maddr=0 msize=80 cell=2 mode=9 size=80 sug=0 addr=80",
+	} {
+		_, err := ReadTierraRecords(strings.NewReader("\n" + log))
+		if assert.Error(t, err, log) {
+			assert.Equal(t, ErrTrace, errors.Cause(err), log)
+			assert.Contains(t, err.Error(), "line 2", log)
+		}
+	}
+}
+
+func TestTierraOps(t *testing.T) {
+	records, _ := ReadTierraRecords(strings.NewReader(tierraRecords))
+
+	var lines []string
+	for _, op := range TierraOps(records) {
+		lines = append(lines, op.String())
+	}
+
+	assert.Equal(t, []string{
+		"alloc 80 0 80 0",
+		"alloc 80 0 80 80",
+		"alloc 40 80 80 500",
+		"free 0 80",
+		"alloc 60 80 80 0",
+	}, lines)
+}
+
+// TestTierraOpsReplay checks that the ops of a run where gtm would choose
+// other addresses replay without errors and leave the memory of Tierra.
+func TestTierraOpsReplay(t *testing.T) {
+	records, _ := ReadTierraRecords(strings.NewReader(tierraRecords))
+	a := NewAllocator(NewTreeIndex(ctree.New(1000)), DefaultParams(1000), 0)
+
+	for _, op := range TierraOps(records) {
+		res, err := a.Replay(op)
+		if !assert.NoError(t, err, "%v", op) {
+			return
+		}
+		if op.Kind == OpAlloc {
+			assert.Equal(t, op.SugAddr, res.Address, "%v", op)
+		}
+	}
+
+	assert.Equal(t, []ctree.Frame{{Address: 60, Length: 20}, {Address: 160, Length: 340}, {Address: 540, Length: 460}},
+		indexFrames(a.Index))
+}
+
+func TestCompareTierra(t *testing.T) {
+	records, _ := ReadTierraRecords(strings.NewReader(tierraRecords))
+	a := NewAllocator(NewTreeIndex(ctree.New(1000)), DefaultParams(1000), 0)
+
+	report := CompareTierra(a, records)
+
+	assert.Equal(t, 3, report.Mals)
+	assert.Equal(t, 2, report.Matches)
+	if assert.Len(t, report.Mismatches, 1) {
+		m := report.Mismatches[0]
+		assert.Equal(t, 6, m.Record.Line)
+		assert.Equal(t, int32(160), m.Address)
+	}
+	assert.Equal(t, "line 6: cell 3 allocated at 160 instead of 500\n"+
+		"2 of 3 allocations at the same address, 1 mismatches", report.String())
+}
+
+func TestCompareTierraFailedMal(t *testing.T) {
+	records, _ := ReadTierraRecords(strings.NewReader(`0 birth cell=1 addr=0 size=80
+10 mal mother=1 maddr=0 msize=80 cell=2 mode=1 size=300 sug=0 addr=80
+12 birth cell=2 addr=80 size=300
+20 death cell=2 addr=80 size=300
+`))
+	a := NewAllocator(NewTreeIndex(ctree.New(1000)), DefaultParams(1000), 0)
+
+	report := CompareTierra(a, records)
+
+	if assert.Len(t, report.Mismatches, 1) {
+		assert.Equal(t, 2, report.Mismatches[0].Record.Line)
+		assert.Equal(t, ErrInvalidSize, errors.Cause(report.Mismatches[0].Err))
+	}
+	assert.Equal(t, int64(920), a.Stats().Free)
+}
+
+func TestCompareTierraUnknownCell(t *testing.T) {
+	records, _ := ReadTierraRecords(strings.NewReader("5 death cell=7 addr=0 size=80"))
+	a := NewAllocator(NewTreeIndex(ctree.New(1000)), DefaultParams(1000), 0)
+
+	report := CompareTierra(a, records)
+
+	if assert.Len(t, report.Mismatches, 1) {
+		assert.EqualError(t, report.Mismatches[0].Err, "death of unknown cell 7")
+	}
+}
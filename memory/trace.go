@@ -0,0 +1,332 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+// This file contains code for recording the requests of an Allocator and
+// reading them back
+
+package memory
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// A trace is a text file with one request per line. Empty lines and lines
+// starting with # are ignored. The lines are:
+//
+//	param <name> <value>
+//	seed <seed>
+//	soup <size>
+//	mode <mode>
+//	alloc <size> <mother address> <mother size> <suggested address>
+//	free <address> <size>
+//
+// The trace starts with a header describing the Allocator. The param lines
+// set the fields of the Params: mincellsize, maxmalmult, maltol, avgsize,
+// flawrate, flawmagnitude, flawseed and index, whose value is the name
+// returned by IndexKind.String. The seed line gives the seed of the
+// Allocator. Missing params keep the values of DefaultParams and the seed is
+// 0 when missing. The soup line ends the header and gives the size of the
+// soup.
+//
+// The mode line sets the mode of the following alloc lines, it can be a
+// number or the name returned by Mode.String. The initial mode is BetterFit.
+//
+// The memory freed by reaping is recorded as free lines before the alloc line
+// that caused it, so that a trace can be replayed without a Reaper.
+// Replaying the RandomPref mode or an allocator with flaws gives the same
+// results only if the Allocator is created with the Params and the seed of
+// the header.
+
+// ErrTrace is the cause of all errors returned while reading a trace.
+var ErrTrace = errors.New("invalid trace")
+
+// OpKind is the kind of a request in a trace.
+type OpKind int
+
+// Kinds of requests.
+const (
+	OpSoup  OpKind = iota // size of the soup
+	OpAlloc               // Allocator.Mal
+	OpFree                // Allocator.Dealloc
+)
+
+// Op is a request read from a trace.
+type Op struct {
+	Kind OpKind
+	Line int // line of the trace
+
+	Size    int32   // size of the soup or of the block
+	Params  Params  // parameters of the soup, SoupSize is Size
+	Seed    int64   // seed of the Allocator of the soup
+	Mode    Mode    // mode of an alloc
+	Mother  Segment // mother of an alloc
+	SugAddr int32   // suggested address of an alloc
+	Segment Segment // block to free
+}
+
+// String returns the op as a line of a trace. The header lines of a soup
+// op are not included.
+func (op Op) String() string {
+	switch op.Kind {
+	case OpSoup:
+		return fmt.Sprintf("soup %d", op.Size)
+	case OpAlloc:
+		return fmt.Sprintf("alloc %d %d %d %d", op.Size, op.Mother.Address, op.Mother.Size, op.SugAddr)
+	case OpFree:
+		return fmt.Sprintf("free %d %d", op.Segment.Address, op.Segment.Size)
+	}
+	return fmt.Sprintf("OpKind(%d)", int(op.Kind))
+}
+
+// Replay performs op on the Allocator. Only alloc ops return an Allocation.
+func (a *Allocator) Replay(op Op) (Allocation, error) {
+	switch op.Kind {
+	case OpAlloc:
+		return a.Mal(op.Mother, op.SugAddr, op.Size, op.Mode)
+	case OpFree:
+		return Allocation{}, a.Dealloc(op.Segment)
+	}
+	return Allocation{}, nil
+}
+
+// ParseMode returns the Mode with the given name or number.
+func ParseMode(s string) (Mode, error) {
+	for m, name := range modeNames {
+		if s == name {
+			return Mode(m), nil
+		}
+	}
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 && n < len(modeNames) {
+		return Mode(n), nil
+	}
+	return 0, errors.Wrapf(ErrInvalidMode, "mode %q", s)
+}
+
+// TraceReader reads the requests of a trace one by one.
+type TraceReader struct {
+	scanner *bufio.Scanner
+	line    int
+	mode    Mode
+	params  Params
+	seed    int64
+	soup    bool // the header has been read
+}
+
+// NewTraceReader returns a TraceReader reading from r.
+func NewTraceReader(r io.Reader) *TraceReader {
+	return &TraceReader{
+		scanner: bufio.NewScanner(r),
+		mode:    BetterFit,
+		params:  DefaultParams(0),
+	}
+}
+
+// Read returns the next request of the trace. Mode, param and seed lines
+// are not returned: the mode is stored in the following alloc ops, the
+// params and the seed in the soup op. At the end of the trace io.EOF is
+// returned.
+func (r *TraceReader) Read() (Op, error) {
+	for r.scanner.Scan() {
+		r.line++
+		fields := strings.Fields(r.scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		switch fields[0] {
+		case "param", "seed":
+			if err := r.header(fields); err != nil {
+				return Op{}, err
+			}
+			continue
+		}
+
+		if fields[0] == "mode" {
+			if len(fields) != 2 {
+				return Op{}, r.errorf("mode needs 1 argument")
+			}
+			m, err := ParseMode(fields[1])
+			if err != nil {
+				return Op{}, r.errorf("%v", err)
+			}
+			r.mode = m
+			continue
+		}
+
+		op := Op{Line: r.line}
+		var args []*int32
+		switch fields[0] {
+		case "soup":
+			op.Kind = OpSoup
+			args = []*int32{&op.Size}
+		case "alloc":
+			op.Kind, op.Mode = OpAlloc, r.mode
+			args = []*int32{&op.Size, &op.Mother.Address, &op.Mother.Size, &op.SugAddr}
+		case "free":
+			op.Kind = OpFree
+			args = []*int32{&op.Segment.Address, &op.Segment.Size}
+		default:
+			return Op{}, r.errorf("unknown request %q", fields[0])
+		}
+		if len(fields)-1 != len(args) {
+			return Op{}, r.errorf("%s needs %d arguments", fields[0], len(args))
+		}
+		for i, arg := range args {
+			n, err := strconv.ParseInt(fields[i+1], 10, 32)
+			if err != nil {
+				return Op{}, r.errorf("bad number %q", fields[i+1])
+			}
+			*arg = int32(n)
+		}
+		if op.Kind == OpSoup {
+			r.soup = true
+			op.Params, op.Seed = r.params, r.seed
+			op.Params.SoupSize = op.Size
+		}
+		return op, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return Op{}, err
+	}
+	return Op{}, io.EOF
+}
+
+// header reads a param or seed line.
+func (r *TraceReader) header(fields []string) error {
+	if r.soup {
+		return r.errorf("%s after soup", fields[0])
+	}
+	if fields[0] == "seed" {
+		if len(fields) != 2 {
+			return r.errorf("seed needs 1 argument")
+		}
+		n, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return r.errorf("bad number %q", fields[1])
+		}
+		r.seed = n
+		return nil
+	}
+
+	if len(fields) != 3 {
+		return r.errorf("param needs 2 arguments")
+	}
+	p := &r.params
+	name, value := fields[1], fields[2]
+	var arg *int32
+	switch name {
+	case "mincellsize":
+		arg = &p.MinCellSize
+	case "maxmalmult":
+		arg = &p.MaxMalMult
+	case "maltol":
+		arg = &p.MalTol
+	case "avgsize":
+		arg = &p.AvgSize
+	case "flawmagnitude":
+		arg = &p.Flaws.Magnitude
+	case "flawrate":
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return r.errorf("bad number %q", value)
+		}
+		p.Flaws.Rate = rate
+		return nil
+	case "flawseed":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return r.errorf("bad number %q", value)
+		}
+		p.Flaws.Seed = n
+		return nil
+	case "index":
+		for k, s := range indexNames {
+			if value == s {
+				p.Index = IndexKind(k)
+				return nil
+			}
+		}
+		return r.errorf("unknown index %q", value)
+	default:
+		return r.errorf("unknown param %q", name)
+	}
+	n, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return r.errorf("bad number %q", value)
+	}
+	*arg = int32(n)
+	return nil
+}
+
+func (r *TraceReader) errorf(format string, args ...interface{}) error {
+	return errors.Wrapf(ErrTrace, "line %d: %s", r.line, fmt.Sprintf(format, args...))
+}
+
+// Recorder writes the requests of an Allocator as a trace. It is enabled by
+// setting the Recorder field of the Allocator.
+// Write errors do not affect the Allocator, the first one is kept and
+// returned by Err.
+type Recorder struct {
+	w       io.Writer
+	started bool
+	mode    Mode
+	err     error
+}
+
+// NewRecorder returns a Recorder writing to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{w: w, mode: BetterFit}
+}
+
+// Err returns the first error that occurred while writing the trace.
+func (r *Recorder) Err() error {
+	return r.err
+}
+
+// alloc records a Mal request of a.
+func (r *Recorder) alloc(a *Allocator, mother Segment, sugAddr, sugSize int32, mode Mode) {
+	r.start(a)
+	if mode != r.mode {
+		r.mode = mode
+		r.printf("mode %v\n", mode)
+	}
+	r.printf("%v\n", Op{Kind: OpAlloc, Size: sugSize, Mother: mother, SugAddr: sugAddr})
+}
+
+// free records a Dealloc request of a.
+func (r *Recorder) free(a *Allocator, seg Segment) {
+	r.start(a)
+	r.printf("%v\n", Op{Kind: OpFree, Segment: seg})
+}
+
+// start writes the header of the trace before the first request.
+func (r *Recorder) start(a *Allocator) {
+	if r.started {
+		return
+	}
+	r.started = true
+	p := &a.Params
+	r.printf("param mincellsize %d\n", p.MinCellSize)
+	r.printf("param maxmalmult %d\n", p.MaxMalMult)
+	r.printf("param maltol %d\n", p.MalTol)
+	r.printf("param avgsize %d\n", p.AvgSize)
+	r.printf("param flawrate %v\n", p.Flaws.Rate)
+	r.printf("param flawmagnitude %d\n", p.Flaws.Magnitude)
+	r.printf("param flawseed %d\n", p.Flaws.Seed)
+	r.printf("param index %v\n", p.Index)
+	r.printf("seed %d\n", a.seed)
+	r.printf("%v\n", Op{Kind: OpSoup, Size: p.SoupSize})
+}
+
+func (r *Recorder) printf(format string, args ...interface{}) {
+	if r.err == nil {
+		_, r.err = fmt.Fprintf(r.w, format, args...)
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModeString(t *testing.T) {
+	assert.Equal(t, "nearmother", NearMother.String())
+	assert.Equal(t, "Mode(9)", Mode(9).String())
+}
+
+func TestParseMode(t *testing.T) {
+	m, err := ParseMode("suggestedfit")
+	if assert.NoError(t, err) {
+		assert.Equal(t, SuggestedFit, m)
+	}
+	m, err = ParseMode("3")
+	if assert.NoError(t, err) {
+		assert.Equal(t, NearMother, m)
+	}
+	_, err = ParseMode("7")
+	assert.Equal(t, ErrInvalidMode, errors.Cause(err))
+}
+
+func TestRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	s, _ := NewSoup(100)
+	rec := NewRecorder(&buf)
+	s.Record(rec)
+	q := &ReapQueue{}
+	s.Reaper = q
+
+	s.Mal(1, mother, 0, 60, BetterFit)
+	q.Add(Cell{ID: 1})
+	s.Mal(2, mother, 7, 50, NearAddress)
+	s.Free(7)
+
+	assert.NoError(t, rec.Err())
+	assert.Equal(t, `param mincellsize 12
+param maxmalmult 3
+param maltol 20
+param avgsize 80
+param flawrate 0
+param flawmagnitude 0
+param flawseed 0
+param index ctree
+seed 0
+soup 100
+alloc 60 100 80 0
+free 0 60
+mode nearaddress
+alloc 50 100 80 7
+free 7 50
+`, buf.String())
+}
+
+func TestTraceReader(t *testing.T) {
+	r := NewTraceReader(strings.NewReader(`# a trace
+param maltol 5
+param flawrate 0.25
+param flawseed 7
+param index bst
+seed 42
+soup 1000
+
+alloc 40 100 80 0
+mode 3
+alloc 20 100 80 0
+free 0 40
+`))
+
+	var ops []Op
+	for {
+		op, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+		ops = append(ops, op)
+	}
+
+	p := DefaultParams(1000)
+	p.MalTol = 5
+	p.Flaws = Flaws{Rate: 0.25, Seed: 7}
+	p.Index = BalancedTrees
+	assert.Equal(t, []Op{
+		{Kind: OpSoup, Line: 7, Size: 1000, Params: p, Seed: 42},
+		{Kind: OpAlloc, Line: 9, Size: 40, Mode: BetterFit, Mother: mother},
+		{Kind: OpAlloc, Line: 11, Size: 20, Mode: NearMother, Mother: mother},
+		{Kind: OpFree, Line: 12, Segment: Segment{Address: 0, Size: 40}},
+	}, ops)
+}
+
+func TestTraceReaderErrors(t *testing.T) {
+	for _, trace := range []string{
+		"grow 10",
+		"alloc 10 20",
+		"free 10 x",
+		"mode",
+		"mode worstfit",
+		"soup 9999999999",
+		"param avgsize",
+		"param avgsize x",
+		"param flawrate x",
+		"param index heap",
+		"param size 10",
+		"seed x",
+	} {
+		_, err := NewTraceReader(strings.NewReader("\n" + trace)).Read()
+		if assert.Error(t, err, trace) {
+			assert.Equal(t, ErrTrace, errors.Cause(err), trace)
+			assert.Contains(t, err.Error(), "line 2", trace)
+		}
+	}
+}
+
+func TestTraceReaderParamAfterSoup(t *testing.T) {
+	r := NewTraceReader(strings.NewReader("soup 100\nparam maltol 5"))
+
+	_, err := r.Read()
+	if assert.NoError(t, err) {
+		_, err = r.Read()
+		assert.EqualError(t, err, "line 2: param after soup: invalid trace")
+	}
+}
+
+func TestReplayFreeOutOfSoup(t *testing.T) {
+	for _, free := range []string{"free 2147483600 100", "free -10 20", "free 990 20", "free 10 0"} {
+		r := NewTraceReader(strings.NewReader("soup 1000\n" + free))
+		op, _ := r.Read()
+		index, _ := NewFreeIndex(op.Params.Index, op.Size)
+		a := NewAllocator(index, op.Params, op.Seed)
+
+		op, err := r.Read()
+		if assert.NoError(t, err, free) {
+			_, err = a.Replay(op)
+			assert.Equal(t, ErrOutOfSoup, errors.Cause(err), free)
+		}
+		assert.Equal(t, int64(1000), a.Stats().Free, free)
+	}
+}
+
+// TestReplay records a run with reaping and checks that replaying its trace
+// leaves the same free Frames.
+func TestReplay(t *testing.T) {
+	var buf bytes.Buffer
+	p := DefaultParams(1000)
+	p.Flaws = Flaws{Rate: 0.3, Magnitude: 5, Seed: 3}
+	p.Index = SegregatedLists
+	s, _ := NewSoupWithParams(p, 9)
+	s.Record(NewRecorder(&buf))
+	q := &ReapQueue{}
+	s.Reaper = q
+	for i := 1; i <= 30; i++ {
+		s.Mal(i, mother, int32(i*37), int32(20+i%5*10), Mode(i%7))
+		q.Add(Cell{ID: i})
+		if i%4 == 0 {
+			s.FreeCell(i - 1)
+		}
+	}
+
+	r := NewTraceReader(&buf)
+	op, err := r.Read()
+	if !assert.NoError(t, err) || !assert.Equal(t, OpSoup, op.Kind) {
+		return
+	}
+	assert.Equal(t, p, op.Params)
+	assert.Equal(t, int64(9), op.Seed)
+	index, _ := NewFreeIndex(op.Params.Index, op.Size)
+	a := NewAllocator(index, op.Params, op.Seed)
+	for {
+		op, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+		// allocations that failed in the recorded run fail again
+		a.Replay(op)
+	}
+
+	assert.Equal(t, s.Stats(), a.Stats())
+	assert.Equal(t, indexFrames(s.alloc.Index), indexFrames(a.Index))
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+// This file contains a generator of synthetic allocation workloads
+
+package memory
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// WorkloadKind selects the behaviour of the cells of a Workload.
+type WorkloadKind int
+
+// Kinds of workloads.
+const (
+	// Uniform cells have a size uniformly distributed between MinCellSize
+	// and twice AvgSize and die at random.
+	Uniform WorkloadKind = iota
+
+	// Bimodal cells are like the ones of a Tierra soup where hosts of
+	// AvgSize slots live together with parasites of half that size.
+	Bimodal
+
+	// Bursty cells have the same sizes of Uniform cells but never die at
+	// random. From time to time a large part of the population is killed
+	// at once.
+	Bursty
+)
+
+var workloadNames = [...]string{
+	Uniform: "uniform",
+	Bimodal: "bimodal",
+	Bursty:  "bursty",
+}
+
+func (k WorkloadKind) String() string {
+	if k >= 0 && int(k) < len(workloadNames) {
+		return workloadNames[k]
+	}
+	return fmt.Sprintf("WorkloadKind(%d)", int(k))
+}
+
+// Parameters of the workloads.
+const (
+	deathRate    = 0.5  // probability of a random death at each step
+	parasiteRate = 0.3  // fraction of parasites in a Bimodal workload
+	burstPeriod  = 1000 // steps between two bursts of deaths
+	burstDeaths  = 0.5  // fraction of the population killed by a burst
+)
+
+// Workload generates a synthetic sequence of allocation requests for an
+// Allocator. Each Step allocates the daughter of a living cell, after the
+// deaths scheduled for that step. The Workload is also the Reaper of the
+// Allocator: when the soup is full, random living cells are reaped.
+type Workload struct {
+	Kind WorkloadKind
+	Mode Mode // mode of the allocations
+
+	a     *Allocator
+	rand  *rand.Rand
+	cells []Cell // living cells
+	next  int    // ID of the next cell
+	steps int
+}
+
+// NewWorkload returns a Workload of the given kind for a. It replaces the
+// Reaper of a. The seed initializes the random generator of the Workload.
+func NewWorkload(a *Allocator, kind WorkloadKind, seed int64) *Workload {
+	w := &Workload{
+		Kind: kind,
+		Mode: BetterFit,
+		a:    a,
+		rand: rand.New(rand.NewSource(seed)),
+	}
+	a.Reaper = w
+	return w
+}
+
+// Live returns the number of living cells.
+func (w *Workload) Live() int {
+	return len(w.cells)
+}
+
+// Step performs the deaths of one step and allocates one block. The daughter
+// is placed near a random living cell, which is taken as mother, and is
+// added to the living cells.
+func (w *Workload) Step() (Allocation, error) {
+	w.steps++
+	switch {
+	case w.Kind == Bursty && w.steps%burstPeriod == 0:
+		for n := int(float64(len(w.cells)) * burstDeaths); n > 0; n-- {
+			if err := w.kill(); err != nil {
+				return Allocation{}, err
+			}
+		}
+	case w.Kind != Bursty && len(w.cells) > 0 && w.rand.Float64() < deathRate:
+		if err := w.kill(); err != nil {
+			return Allocation{}, err
+		}
+	}
+
+	size := w.size()
+	// the mother is as large as the daughter, so that the size is accepted
+	mother := Segment{Size: size}
+	if len(w.cells) > 0 {
+		mother.Address = w.cells[w.rand.Intn(len(w.cells))].Segments[0].Address
+	}
+	res, err := w.a.Mal(mother, w.rand.Int31n(w.a.Params.SoupSize), size, w.Mode)
+	if err != nil {
+		return res, err
+	}
+	w.next++
+	w.cells = append(w.cells, Cell{ID: w.next, Segments: []Segment{res.Segment}})
+	return res, nil
+}
+
+// size returns the size of a new cell.
+func (w *Workload) size() int32 {
+	p := &w.a.Params
+	var size int32
+	switch {
+	case w.Kind == Bimodal && w.rand.Float64() < parasiteRate:
+		size = int32(w.rand.NormFloat64()*float64(p.AvgSize)/20) + p.AvgSize/2
+	case w.Kind == Bimodal:
+		size = int32(w.rand.NormFloat64()*float64(p.AvgSize)/10) + p.AvgSize
+	default:
+		size = p.MinCellSize + w.rand.Int31n(2*p.AvgSize-p.MinCellSize+1)
+	}
+	if size < p.MinCellSize {
+		size = p.MinCellSize
+	}
+	return size
+}
+
+// take removes a random cell from the living ones and returns it.
+func (w *Workload) take() Cell {
+	i := w.rand.Intn(len(w.cells))
+	c := w.cells[i]
+	last := len(w.cells) - 1
+	w.cells[i] = w.cells[last]
+	w.cells = w.cells[:last]
+	return c
+}
+
+// kill frees the memory of a random living cell.
+func (w *Workload) kill() error {
+	for _, s := range w.take().Segments {
+		if err := w.a.Dealloc(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reap implements Reaper.
+func (w *Workload) Reap() (Cell, bool) {
+	if len(w.cells) == 0 {
+		return Cell{}, false
+	}
+	return w.take(), true
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2017 Andrea Cisternino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newWorkload returns a Workload on an empty soup of the given size, whose
+// free memory is kept in an index of the given kind.
+func newWorkload(size int32, kind WorkloadKind, index IndexKind) *Workload {
+	free, _ := NewFreeIndex(index, size)
+	a := NewAllocator(free, DefaultParams(size), 1)
+	return NewWorkload(a, kind, 1)
+}
+
+func TestWorkload(t *testing.T) {
+	for _, kind := range []WorkloadKind{Uniform, Bimodal, Bursty} {
+		w := newWorkload(10000, kind, CartesianTree)
+		reaped := 0
+		for i := 0; i < 5000; i++ {
+			res, err := w.Step()
+			if !assert.NoError(t, err, "%v step %d", kind, i) {
+				break
+			}
+			reaped += res.Reaped
+		}
+
+		used := int64(0)
+		for _, c := range w.cells {
+			used += int64(c.Segments[0].Size)
+		}
+		assert.True(t, reaped > 0, "%v: the soup never got full", kind)
+		assert.Equal(t, int64(10000), used+w.a.Stats().Free, "%v", kind)
+		assert.NoError(t, w.a.Index.(*TreeIndex).Validate(), "%v", kind)
+	}
+}
+
+func TestWorkloadBimodalSizes(t *testing.T) {
+	w := newWorkload(100000, Bimodal, CartesianTree)
+	small := 0
+	for i := 0; i < 1000; i++ {
+		if res, _ := w.Step(); res.Size < 60 {
+			small++
+		}
+	}
+
+	assert.InDelta(t, 300, small, 60)
+}
+
+func TestWorkloadKindString(t *testing.T) {
+	assert.Equal(t, "bursty", Bursty.String())
+	assert.Equal(t, "WorkloadKind(5)", WorkloadKind(5).String())
+}
+
+// BenchmarkMal measures the allocations of the workloads on soups of
+// increasing size. Before measuring, the soup is filled so that the reaper
+// is at work. Each op is a Step: one Mal, plus the deaths and reaping it
+// causes. Soups larger than 1M slots are skipped in short mode.
+func BenchmarkMal(b *testing.B) {
+	for _, kind := range []WorkloadKind{Uniform, Bimodal, Bursty} {
+		for _, size := range []int32{1e3, 1e5, 1e7, 1e8} {
+			b.Run(fmt.Sprintf("%v/%s", kind, sizeName(size)), func(b *testing.B) {
+				if testing.Short() && size > 1e6 {
+					b.Skip("large soup in short mode")
+				}
+				w := newWorkload(size, kind, CartesianTree)
+				for i := 2 * size / w.a.Params.AvgSize; i > 0; i-- {
+					w.Step()
+				}
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := w.Step(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// sizeName returns a short name for a soup size, like 10K or 100M.
+func sizeName(size int32) string {
+	switch {
+	case size >= 1e6:
+		return fmt.Sprintf("%dM", size/1e6)
+	case size >= 1e3:
+		return fmt.Sprintf("%dK", size/1e3)
+	}
+	return fmt.Sprint(size)
+}
+
+// BenchmarkMalIndex compares the kinds of FreeIndex on the Bimodal workload.
+func BenchmarkMalIndex(b *testing.B) {
+	for _, index := range []IndexKind{CartesianTree, SegregatedLists, BalancedTrees} {
+		for _, mode := range []Mode{BetterFit, NearMother} {
+			for _, size := range []int32{1e5, 1e7} {
+				b.Run(fmt.Sprintf("%v/%v/%s", index, mode, sizeName(size)), func(b *testing.B) {
+					if testing.Short() && size > 1e6 {
+						b.Skip("large soup in short mode")
+					}
+					w := newWorkload(size, Bimodal, index)
+					w.Mode = mode
+					for i := 2 * size / w.a.Params.AvgSize; i > 0; i-- {
+						w.Step()
+					}
+					b.ReportAllocs()
+					b.ResetTimer()
+					for i := 0; i < b.N; i++ {
+						if _, err := w.Step(); err != nil {
+							b.Fatal(err)
+						}
+					}
+				})
+			}
+		}
+	}
+}